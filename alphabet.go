@@ -0,0 +1,87 @@
+package iron
+
+import "strings"
+
+// base64Alphabet is the alphabet of base64.RawURLEncoding, which components
+// are encoded with unless Options.Base64Alphabet is set.
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// checkBase64Alphabet returns a description of the problem with a custom
+// alphabet, or the empty string if it's usable.
+func checkBase64Alphabet(alphabet string) string {
+	if len(alphabet) != len(base64Alphabet) {
+		return "Base64Alphabet must have exactly 64 characters"
+	}
+
+	var seen [256]bool
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		if c <= ' ' || c > '~' || strings.IndexByte(delimiter+extensionSep, c) >= 0 {
+			return "Base64Alphabet may only contain printable ASCII other than separators"
+		}
+		if seen[c] {
+			return "Base64Alphabet may not repeat characters"
+		}
+		seen[c] = true
+	}
+
+	return ""
+}
+
+// base64Extensions are the extensions whose values are base64-encoded.
+var base64Extensions = map[string]bool{"hdr": true, "pur": true, "iss": true, "aud": true, "kcv": true}
+
+// translateBase64 maps each character of s in the from alphabet to the
+// character at the same position in the to alphabet. Other characters are
+// left unchanged, and reported by returning false.
+func translateBase64(s, from, to string) (string, bool) {
+	var table [256]int
+	for i := range table {
+		table[i] = -1
+	}
+	for i := 0; i < len(from); i++ {
+		table[from[i]] = int(to[i])
+	}
+
+	ok := true
+	b := []byte(s)
+	for i, c := range b {
+		if table[c] < 0 {
+			ok = false
+			continue
+		}
+		b[i] = byte(table[c])
+	}
+
+	return string(b), ok
+}
+
+// translateComponents translates the base64 components of the split cookie,
+// including the values of base64 extensions, between alphabets in place. n
+// is the index of the HMAC salt. It returns an UnsealError if a component
+// has a character outside the from alphabet, having translated the rest.
+func (o *Options) translateComponents(parts []string, n int, from, to string) error {
+	indexes := []int{2, 3, 4, n}
+	if o.HMACEncoding == Base64URL {
+		indexes = append(indexes, n+1)
+	}
+
+	valid := true
+	for i := 6; i < n; i++ {
+		if j := strings.Index(parts[i], extensionSep); j >= 0 && base64Extensions[parts[i][:j]] {
+			value, ok := translateBase64(parts[i][j+1:], from, to)
+			parts[i] = parts[i][:j+1] + value
+			valid = valid && ok
+		}
+	}
+	for _, i := range indexes {
+		var ok bool
+		parts[i], ok = translateBase64(parts[i], from, to)
+		valid = valid && ok
+	}
+
+	if !valid {
+		return UnsealError{"Invalid component encoding"}
+	}
+	return nil
+}
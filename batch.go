@@ -0,0 +1,94 @@
+package iron
+
+import (
+	"runtime"
+	"sync"
+)
+
+// BatchOptions limits the resources used by UnsealBatch.
+type BatchOptions struct {
+	// MaxConcurrent is the most cookies unsealed at once. Defaults to
+	// GOMAXPROCS.
+	MaxConcurrent int
+	// MaxTotalBytes bounds the total size of the cookies being unsealed, or
+	// whose payloads are held by the callback, at any one time. A decrypted
+	// payload is shorter than its sealed cookie unless it was compressed,
+	// and compressed payloads inflate to at most Options.MaxPlaintextSize,
+	// so this also bounds the decrypted bytes held at once when that's
+	// set. A single cookie larger than the bound is unsealed alone.
+	// Unlimited if zero.
+	MaxTotalBytes int
+}
+
+// UnsealBatch unseals each of the cookies and passes the result to fn along
+// with the cookie's index. Work is spread across goroutines within the
+// limits of the options, waiting for earlier cookies to finish rather than
+// exceeding them, and fn may be called concurrently and in any order. The
+// payload passed to fn counts against MaxTotalBytes until fn returns.
+func (v *Vault) UnsealBatch(sealed []string, opts BatchOptions, fn func(i int, payload []byte, err error)) {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = runtime.GOMAXPROCS(0)
+	}
+
+	budget := newByteBudget(opts.MaxTotalBytes)
+	slots := make(chan struct{}, opts.MaxConcurrent)
+	var wg sync.WaitGroup
+
+	for i, s := range sealed {
+		size := len(s)
+		budget.acquire(size)
+		slots <- struct{}{}
+		wg.Add(1)
+
+		go func(i int, s string) {
+			defer func() {
+				<-slots
+				budget.release(size)
+				wg.Done()
+			}()
+
+			payload, err := v.Unseal(s)
+			fn(i, payload, err)
+		}(i, s)
+	}
+
+	wg.Wait()
+}
+
+// byteBudget is a counting semaphore over a number of bytes.
+type byteBudget struct {
+	limit int
+	used  int
+	cond  *sync.Cond
+}
+
+func newByteBudget(limit int) *byteBudget {
+	return &byteBudget{limit: limit, cond: sync.NewCond(&sync.Mutex{})}
+}
+
+// acquire blocks until n bytes fit within the budget, or until nothing else
+// holds the budget if n alone exceeds it.
+func (b *byteBudget) acquire(n int) {
+	if b.limit <= 0 {
+		return
+	}
+
+	b.cond.L.Lock()
+	for b.used > 0 && b.used+n > b.limit {
+		b.cond.Wait()
+	}
+	b.used += n
+	b.cond.L.Unlock()
+}
+
+// release returns n bytes to the budget.
+func (b *byteBudget) release(n int) {
+	if b.limit <= 0 {
+		return
+	}
+
+	b.cond.L.Lock()
+	b.used -= n
+	b.cond.L.Unlock()
+	b.cond.Broadcast()
+}
@@ -0,0 +1,83 @@
+package iron
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnsealsBatch(t *testing.T) {
+	v := New(Options{Secret: password})
+	a, err := v.Seal([]byte("a"))
+	assert.Nil(t, err)
+	b, err := v.Seal([]byte("b"))
+	assert.Nil(t, err)
+
+	var mu sync.Mutex
+	results := map[int]string{}
+	errs := map[int]error{}
+	v.UnsealBatch([]string{a, "garbage", b}, BatchOptions{}, func(i int, payload []byte, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[i] = string(payload)
+		errs[i] = err
+	})
+
+	assert.Equal(t, map[int]string{0: "a", 1: "", 2: "b"}, results)
+	assert.Nil(t, errs[0])
+	assert.Equal(t, UnsealError{"Incorrect number of sealed components"}, errs[1])
+	assert.Nil(t, errs[2])
+}
+
+func TestBoundsBatchConcurrencyAndBytes(t *testing.T) {
+	v := New(Options{Secret: password})
+	large := bytes.Repeat([]byte("x"), 4096)
+	cookie, err := v.Seal(large)
+	assert.Nil(t, err)
+
+	sealed := make([]string, 32)
+	for i := range sealed {
+		sealed[i] = cookie
+	}
+
+	for _, opts := range []BatchOptions{
+		{MaxConcurrent: 3},
+		{MaxConcurrent: 8, MaxTotalBytes: 2 * len(cookie)},
+	} {
+		var mu sync.Mutex
+		var inFlight, maxInFlight, held, maxHeld, calls int
+		v.UnsealBatch(sealed, opts, func(i int, payload []byte, err error) {
+			assert.Nil(t, err)
+			assert.Equal(t, large, payload)
+
+			mu.Lock()
+			calls++
+			inFlight++
+			held += len(payload)
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			if held > maxHeld {
+				maxHeld = held
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			inFlight--
+			held -= len(payload)
+			mu.Unlock()
+		})
+
+		assert.Equal(t, len(sealed), calls)
+		assert.True(t, maxInFlight <= opts.MaxConcurrent)
+		if opts.MaxTotalBytes > 0 {
+			assert.True(t, maxHeld <= opts.MaxTotalBytes)
+			assert.True(t, maxInFlight <= 2)
+		}
+	}
+}
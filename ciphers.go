@@ -3,6 +3,9 @@ package iron
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"fmt"
+	"reflect"
+	"sort"
 )
 
 // CipherFactory is a function that takes a key and iv and returns and
@@ -10,13 +13,92 @@ import (
 type CipherFactory func(key, iv []byte) (encrypt cipher.BlockMode, decrypt cipher.BlockMode, err error)
 
 var (
-	// AES256 implements aes-256-cbc encryption.
+	// AES256 implements aes-256-cbc encryption with a 256-bit key. Like
+	// AES128, it accepts any AES key size, so that vaults configured with
+	// another KeyBits before it was checked can still unseal their cookies,
+	// but NewChecked requires KeyBits to be 256. Longer keys, as derived
+	// with Encryption.DerivedKeyBytes, are truncated to the first 32 bytes.
 	AES256 = CipherFactory(func(key, iv []byte) (cipher.BlockMode, cipher.BlockMode, error) {
-		block, err := aes.NewCipher(key)
-		if err != nil {
-			return nil, nil, err
-		}
+		return aesCBC(aesKeyPrefix(key, 32), iv)
+	})
 
-		return cipher.NewCBCEncrypter(block, iv), cipher.NewCBCDecrypter(block, iv), nil
+	// AES128 implements aes-128-cbc encryption with a 128-bit key. Keys
+	// longer than 16 bytes which aren't themselves AES key sizes are
+	// truncated to the first 16.
+	AES128 = CipherFactory(func(key, iv []byte) (cipher.BlockMode, cipher.BlockMode, error) {
+		return aesCBC(aesKeyPrefix(key, 16), iv)
 	})
 )
+
+// ciphers is the registry of ciphers available via CipherByName.
+var ciphers = map[string]CipherFactory{
+	"aes-128-cbc": AES128,
+	"aes-256-cbc": AES256,
+}
+
+// cipherKeyBits is the key size each registered cipher requires, which
+// NewChecked checks Encryption.KeyBits against.
+var cipherKeyBits = map[string]uint{
+	"aes-128-cbc": 128,
+	"aes-256-cbc": 256,
+}
+
+// CipherByName returns the cipher registered under the name, such as
+// "aes-256-cbc". It returns an error if the name is unknown.
+func CipherByName(name string) (CipherFactory, error) {
+	c, ok := ciphers[name]
+	if !ok {
+		return nil, fmt.Errorf("iron-go: unknown cipher %q", name)
+	}
+
+	return c, nil
+}
+
+// SupportedCiphers returns the sorted names accepted by CipherByName.
+func SupportedCiphers() []string {
+	names := make([]string, 0, len(ciphers))
+	for name := range ciphers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// aesKeyPrefix returns the first n bytes of a key longer than n, unless its
+// whole length is an AES key size, which is used as it is.
+func aesKeyPrefix(key []byte, n int) []byte {
+	if len(key) <= n || validAESKeySize(len(key)) {
+		return key
+	}
+
+	return key[:n]
+}
+
+// validAESKeySize reports whether n bytes is an AES key size.
+func validAESKeySize(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
+
+func aesCBC(key, iv []byte) (cipher.BlockMode, cipher.BlockMode, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cipher.NewCBCEncrypter(block, iv), cipher.NewCBCDecrypter(block, iv), nil
+}
+
+// cipherName returns the name the cipher is registered under, or "" if it
+// isn't registered.
+func cipherName(c CipherFactory) string {
+	if c == nil {
+		return ""
+	}
+	for name, registered := range ciphers {
+		if reflect.ValueOf(registered).Pointer() == reflect.ValueOf(c).Pointer() {
+			return name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,70 @@
+package iron
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListsSupportedCiphers(t *testing.T) {
+	assert.Equal(t, []string{"aes-128-cbc", "aes-256-cbc"}, SupportedCiphers())
+
+	for _, name := range SupportedCiphers() {
+		c, err := CipherByName(name)
+		assert.Nil(t, err)
+		assert.NotNil(t, c)
+	}
+
+	_, err := CipherByName("rot13")
+	assert.EqualError(t, err, `iron-go: unknown cipher "rot13"`)
+}
+
+func TestListsSupportedHashes(t *testing.T) {
+	assert.Equal(t, []string{"sha1", "sha256", "sha512"}, SupportedHashes())
+
+	for _, name := range SupportedHashes() {
+		h, err := HashByName(name)
+		assert.Nil(t, err)
+		assert.NotNil(t, h)
+	}
+
+	_, err := HashByName("md5")
+	assert.EqualError(t, err, `iron-go: unknown hash "md5"`)
+}
+
+func TestSealsWithAES128(t *testing.T) {
+	v := New(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 128, Iterations: 1, SaltBits: 32, Cipher: AES128,
+	}})
+
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = NewChecked(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 256, Iterations: 1, SaltBits: 32, Cipher: AES128,
+	}})
+	assert.IsType(t, ConfigError{}, err)
+}
+
+func TestSealsWithEachHash(t *testing.T) {
+	for _, name := range SupportedHashes() {
+		h, _ := HashByName(name)
+		v := New(Options{Secret: password, Integrity: &Integrity{
+			Hash: h, KeyBits: 256, Iterations: 1, SaltBits: 32,
+		}})
+
+		cookie, err := v.Seal(source)
+		assert.Nil(t, err)
+		payload, err := v.Unseal(cookie)
+		assert.Nil(t, err)
+		assert.Equal(t, source, payload)
+
+		if name != "sha256" {
+			_, err = New(Options{Secret: password}).Unseal(cookie)
+			assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+		}
+	}
+}
@@ -1,49 +1,371 @@
 package main
 
 import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/WatchBeam/iron-go"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
-var (
-	secret = kingpin.Flag("secret", "Cookie encryption password").Required().Short('s').String()
-	value  = kingpin.Flag("value", "Cookie contents. If not provided, reads from stdin.").Short('v').String()
-	seal   = kingpin.Command("seal", "Encrypts the cookie")
-	unseal = kingpin.Command("unseal", "Decrypts the cookie")
-)
-
 func main() {
-	cmd := kingpin.Parse()
-	vault := iron.New(iron.Options{Secret: []byte(*secret)})
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command line, reading input from stdin and writing the
+// result to stdout and any errors to stderr. It returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	app := kingpin.New("iron", "Seals and unseals Iron cookies").Writer(stdout).ErrorWriter(stderr)
+	secret := app.Flag("secret", "Cookie encryption password").Short('s').Envar("IRON_SECRET").String()
+	secretFile := app.Flag("secret-file", "File holding the cookie encryption password").PlaceHolder("PATH").String()
+	value := app.Flag("value", "Cookie contents. If not provided, reads from stdin.").Short('v').String()
+	cipher := app.Flag("cipher", "Encryption cipher: "+strings.Join(iron.SupportedCiphers(), ", ")).Default("aes-256-cbc").String()
+	hash := app.Flag("hash", "Integrity hash: "+strings.Join(iron.SupportedHashes(), ", ")).Default("sha256").String()
+	iterations := app.Flag("iterations", "Key derivation iterations").Default("1").Uint()
+	saltBits := app.Flag("salt-bits", "Size of generated salts").Default("32").Uint()
+	timing := app.Flag("timing", "Print the time taken to derive one key, and the total, to stderr, to help choose --iterations").Bool()
+	now := app.Flag("now", "Check expiration as if it were this RFC 3339 time").PlaceHolder("TIME").String()
+	seal := app.Command("seal", "Encrypts the cookie")
+	sealBatch := seal.Flag("batch", "Seal each line of stdin, writing one cookie per line").Bool()
+	sealEnvelope := seal.Flag("envelope", "Wrap the cookie in a JSON envelope recording when it was sealed").Bool()
+	unseal := app.Command("unseal", "Decrypts the cookie")
+	unsealBatch := unseal.Flag("batch", "Unseal each line of stdin, writing one payload per line").Bool()
+	genSecret := app.Command("gen-secret", "Prints a new random secret, base64url-encoded")
+	genBytes := genSecret.Flag("bytes", "Length of the secret in bytes, at least 32").Default("32").Int()
+	inspect := app.Command("inspect", "Prints the cookie's components as JSON, without the secret or verifying it")
+	verify := app.Command("verify", "Checks the cookie's integrity and expiration without decrypting it. Exits 1 if it's invalid, or 3 if it's expired.")
+
+	cmd, err := app.Parse(args)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error parsing arguments:", err)
+		return 2
+	}
 
-	input := *value
-	if input == "" {
-		raw, err := ioutil.ReadAll(os.Stdin)
+	if cmd == genSecret.FullCommand() {
+		secret, err := iron.GenerateSecret(*genBytes)
 		if err != nil {
-			log.Fatal("Error reading from standard input: ", err)
+			fmt.Fprintln(stderr, "Error generating secret:", err)
+			return 1
+		}
+		fmt.Fprintln(stdout, base64.RawURLEncoding.EncodeToString(secret))
+		return 0
+	}
+
+	if cmd == inspect.FullCommand() {
+		input, err := readInput(*value, stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, "Error reading from standard input:", err)
+			return 1
+		}
+		if err := inspectSeal(input, stdout); err != nil {
+			fmt.Fprintln(stderr, "Error inspecting input:", err)
+			return 1
 		}
-		input = string(raw)
+		return 0
 	}
-	input = strings.TrimSpace(input)
 
+	password, err := readSecret(*secret, *secretFile)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error reading secret:", err)
+		return 2
+	}
+	options, err := vaultOptions(*cipher, *hash, *iterations, *saltBits)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error parsing arguments:", err)
+		return 2
+	}
+	options.Secret = password
+	if *now != "" {
+		at, err := time.Parse(time.RFC3339, *now)
+		if err != nil {
+			fmt.Fprintln(stderr, "Error parsing arguments: invalid --now:", err)
+			return 2
+		}
+		options.LocalTimeOffset = time.Until(at)
+	}
+	vault, err := iron.NewChecked(options)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error parsing arguments:", err)
+		return 2
+	}
+
+	var process func(string) (string, error)
+	var action string
 	switch cmd {
 	case seal.FullCommand():
-		sealed, err := vault.Seal([]byte(input))
+		action = "sealing bytes"
+		process = func(input string) (string, error) {
+			sealed, err := vault.Seal([]byte(input))
+			if err != nil || !*sealEnvelope {
+				return sealed, err
+			}
+			return wrapEnvelope(sealed, time.Now())
+		}
+	case unseal.FullCommand():
+		action = "unsealing input"
+		process = func(input string) (string, error) {
+			sealed, err := unwrapEnvelope(input)
+			if err != nil {
+				return "", err
+			}
+			payload, err := vault.Unseal(sealed)
+			return string(payload), err
+		}
+	case verify.FullCommand():
+		process = func(input string) (string, error) {
+			sealed, err := unwrapEnvelope(input)
+			if err != nil {
+				return "", err
+			}
+			return "", vault.Verify(sealed)
+		}
+	}
+
+	if *timing {
+		defer reportTiming(vault, time.Now(), stderr)
+	}
+	if *sealBatch || *unsealBatch {
+		return runBatch(process, action, stdin, stdout, stderr)
+	}
+
+	input, err := readInput(*value, stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error reading from standard input:", err)
+		return 1
+	}
+
+	output, err := process(input)
+	if cmd == verify.FullCommand() {
+		return verifyStatus(err, stderr)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error %s: %s\n", action, err)
+		return 1
+	}
+	io.WriteString(stdout, output)
+
+	return 0
+}
+
+// reportTiming writes the time since start, and the time the vault takes to
+// derive a key, to stderr as "derivation: " and "total: " lines of
+// durations.
+func reportTiming(vault *iron.Vault, start time.Time, stderr io.Writer) {
+	total := time.Since(start)
+	derivationStart := time.Now()
+	if _, err := vault.IntegrityHasher([]byte("iron-timing-salt")); err != nil {
+		fmt.Fprintln(stderr, "Error timing key derivation:", err)
+		return
+	}
+	fmt.Fprintf(stderr, "derivation: %s\ntotal: %s\n", time.Since(derivationStart), total)
+}
+
+// readInput returns the value, or if it's empty, the whole of stdin, less
+// surrounding whitespace.
+func readInput(value string, stdin io.Reader) (string, error) {
+	if value == "" {
+		raw, err := ioutil.ReadAll(stdin)
 		if err != nil {
-			log.Fatal("Error sealing bytes", err)
+			return "", err
 		}
-		os.Stdout.Write([]byte(sealed))
+		value = string(raw)
+	}
 
-	case unseal.FullCommand():
-		sealed, err := vault.Unseal(input)
+	return strings.TrimSpace(value), nil
+}
+
+// inspection is the JSON inspect prints for a cookie.
+type inspection struct {
+	Prefix         string `json:"prefix"`
+	PasswordID     string `json:"passwordId"`
+	SaltLength     int    `json:"saltLength"`
+	IV             string `json:"iv"`
+	BodyLength     int    `json:"bodyLength"`
+	HMACSaltLength int    `json:"hmacSaltLength"`
+	HMAC           string `json:"hmac"`
+	Expiration     string `json:"expiration,omitempty"`
+	IssuedAt       string `json:"issuedAt,omitempty"`
+	// ParametersEmbedded, Cipher and Hash report the parameters embedded
+	// in the cookie, if any.
+	ParametersEmbedded bool   `json:"parametersEmbedded"`
+	Cipher             string `json:"cipher,omitempty"`
+	Hash               string `json:"hash,omitempty"`
+}
+
+// inspectSeal writes the cleartext components of the cookie, which may be
+// in an envelope, to w as JSON.
+func inspectSeal(input string, w io.Writer) error {
+	sealed, err := unwrapEnvelope(input)
+	if err != nil {
+		return err
+	}
+	parsed, err := iron.ParseSeal(sealed)
+	if err != nil {
+		return err
+	}
+
+	out := inspection{
+		Prefix:         parsed.Prefix,
+		PasswordID:     parsed.PasswordID,
+		SaltLength:     parsed.SaltLength,
+		IV:             hex.EncodeToString(parsed.IV),
+		BodyLength:     parsed.BodyLength,
+		HMACSaltLength: parsed.HMACSaltLength,
+		HMAC:           hex.EncodeToString(parsed.HMAC),
+
+		ParametersEmbedded: parsed.ParametersEmbedded,
+		Cipher:             parsed.Cipher,
+		Hash:               parsed.Hash,
+	}
+	if !parsed.Expiration.IsZero() {
+		out.Expiration = parsed.Expiration.UTC().Format(time.RFC3339Nano)
+	}
+	if !parsed.IssuedAt.IsZero() {
+		out.IssuedAt = parsed.IssuedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// runBatch processes each line of stdin, writing one line of output for
+// each. Lines which fail are reported to stderr, with an empty line of
+// output, and processing continues; the exit status is 1 if any failed.
+func runBatch(process func(string) (string, error), action string, stdin io.Reader, stdout, stderr io.Writer) int {
+	status := 0
+	scanner := bufio.NewScanner(stdin)
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		output, err := process(strings.TrimRight(scanner.Text(), "\r"))
 		if err != nil {
-			log.Fatal("Error unsealing input: ", err)
+			fmt.Fprintf(stderr, "Error %s on line %d: %s\n", action, line, err)
+			status = 1
 		}
-		os.Stdout.Write(sealed)
+		fmt.Fprintln(stdout, output)
 	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(stderr, "Error reading from standard input:", err)
+		return 1
+	}
+
+	return status
+}
+
+// envelope is the JSON object --envelope wraps cookies in, so that stored
+// cookies are self-describing.
+type envelope struct {
+	Version int    `json:"v"`
+	Sealed  string `json:"sealed"`
+	Created string `json:"created"`
+}
+
+// wrapEnvelope returns the cookie wrapped in a JSON envelope.
+func wrapEnvelope(sealed string, created time.Time) (string, error) {
+	b, err := json.Marshal(envelope{Version: 1, Sealed: sealed, Created: created.UTC().Format(time.RFC3339)})
+	return string(b), err
+}
+
+// unwrapEnvelope returns the cookie in the input, which may be a bare
+// cookie or a JSON envelope.
+func unwrapEnvelope(input string) (string, error) {
+	if !strings.HasPrefix(input, "{") {
+		return input, nil
+	}
+
+	var env envelope
+	if err := json.Unmarshal([]byte(input), &env); err != nil {
+		return "", fmt.Errorf("invalid envelope: %s", err)
+	}
+	if env.Version != 1 {
+		return "", fmt.Errorf("unsupported envelope version %d", env.Version)
+	}
+
+	return env.Sealed, nil
+}
+
+// cipherKeyBits is the key size of each cipher.
+var cipherKeyBits = map[string]uint{
+	"aes-128-cbc": 128,
+	"aes-256-cbc": 256,
+}
+
+// vaultOptions returns Options using the named cipher and hash, and the
+// iterations and salt size for both encryption and integrity, as another
+// implementation might be configured.
+func vaultOptions(cipherName, hashName string, iterations, saltBits uint) (iron.Options, error) {
+	cipher, err := iron.CipherByName(cipherName)
+	if err != nil {
+		return iron.Options{}, err
+	}
+	hash, err := iron.HashByName(hashName)
+	if err != nil {
+		return iron.Options{}, err
+	}
+
+	return iron.Options{
+		Encryption: &iron.Encryption{
+			IVBits:     16,
+			KeyBits:    cipherKeyBits[cipherName],
+			Iterations: iterations,
+			SaltBits:   saltBits,
+			Cipher:     cipher,
+		},
+		Integrity: &iron.Integrity{
+			Hash:       hash,
+			KeyBits:    256,
+			Iterations: iterations,
+			SaltBits:   saltBits,
+		},
+	}, nil
+}
+
+// verifyStatus reports the result of verifying a cookie to stderr, by
+// category, and returns the exit status: 0 if it's valid, 3 if it's
+// expired, and 1 if it's otherwise invalid.
+func verifyStatus(err error, stderr io.Writer) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, iron.ErrExpired):
+		fmt.Fprintln(stderr, "expired:", err)
+		return 3
+	default:
+		fmt.Fprintln(stderr, "invalid:", err)
+		return 1
+	}
+}
+
+// readSecret returns the secret given by --secret or IRON_SECRET, or read
+// from the --secret-file path, less any trailing newline. Exactly one must
+// be given.
+func readSecret(secret, path string) ([]byte, error) {
+	switch {
+	case secret != "" && path != "":
+		return nil, errors.New("--secret-file may not be used with --secret or IRON_SECRET")
+	case secret != "":
+		return []byte(secret), nil
+	case path == "":
+		return nil, errors.New("one of --secret, --secret-file or IRON_SECRET is required")
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b = []byte(strings.TrimRight(string(b), "\r\n"))
+	if len(b) == 0 {
+		return nil, fmt.Errorf("secret file %s is empty", path)
+	}
+
+	return b, nil
 }
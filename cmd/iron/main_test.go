@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WatchBeam/iron-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const password = "some_not_random_password_that_is_also_long_enough"
+
+// runCLI runs the command line with the input on stdin, returning its exit
+// status, stdout and stderr.
+func runCLI(input string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(input), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestSealsAndUnseals(t *testing.T) {
+	status, sealed, _ := runCLI("hello", "--secret", password, "seal")
+	assert.Equal(t, 0, status)
+	assert.True(t, strings.HasPrefix(sealed, "Fe26.2*"))
+
+	status, unsealed, _ := runCLI(sealed, "--secret", password, "unseal")
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "hello", unsealed)
+
+	status, _, stderr := runCLI(sealed, "--secret", strings.ToUpper(password), "unseal")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "Bad hmac value")
+}
+
+func TestProcessesBatches(t *testing.T) {
+	status, sealed, stderr := runCLI("one\ntwo\n\nfour\n", "--secret", password, "seal", "--batch")
+	assert.Equal(t, 0, status)
+	assert.Empty(t, stderr)
+	cookies := strings.Split(strings.TrimSuffix(sealed, "\n"), "\n")
+	assert.Len(t, cookies, 4)
+
+	cookies[1] = "not a cookie"
+	status, unsealed, stderr := runCLI(strings.Join(cookies, "\n"), "--secret", password, "unseal", "--batch")
+	assert.Equal(t, 1, status)
+	assert.Equal(t, "one\n\n\nfour\n", unsealed)
+	assert.Equal(t, "Error unsealing input on line 2: Incorrect number of sealed components\n", stderr)
+}
+
+func TestSelectsCipherAndHash(t *testing.T) {
+	v := iron.New(iron.Options{
+		Secret: []byte(password),
+		Encryption: &iron.Encryption{
+			IVBits: 16, KeyBits: 128, Iterations: 2, SaltBits: 16, Cipher: iron.AES128,
+		},
+		Integrity: &iron.Integrity{
+			Hash: sha512.New, KeyBits: 256, Iterations: 2, SaltBits: 16,
+		},
+	})
+	fixture, err := v.Seal([]byte("hello"))
+	assert.Nil(t, err)
+
+	status, _, stderr := runCLI(fixture, "--secret", password, "unseal")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "Bad hmac value")
+
+	args := []string{"--secret", password, "--cipher", "aes-128-cbc", "--hash", "sha512", "--iterations", "2", "--salt-bits", "16"}
+	status, unsealed, _ := runCLI(fixture, append(args, "unseal")...)
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "hello", unsealed)
+
+	status, sealed, _ := runCLI("again", append(args, "seal")...)
+	assert.Equal(t, 0, status)
+	payload, err := v.Unseal(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, "again", string(payload))
+
+	status, _, stderr = runCLI(fixture, "--secret", password, "--cipher", "des", "unseal")
+	assert.Equal(t, 2, status)
+	assert.Contains(t, stderr, `unknown cipher "des"`)
+	status, _, stderr = runCLI(fixture, "--secret", password, "--hash", "md5", "unseal")
+	assert.Equal(t, 2, status)
+	assert.Contains(t, stderr, `unknown hash "md5"`)
+}
+
+func TestSealsEnvelopes(t *testing.T) {
+	status, output, _ := runCLI("hello", "--secret", password, "seal", "--envelope")
+	assert.Equal(t, 0, status)
+
+	var env map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(output), &env))
+	assert.Equal(t, float64(1), env["v"])
+	assert.True(t, strings.HasPrefix(env["sealed"].(string), "Fe26.2*"))
+	created, err := time.Parse(time.RFC3339, env["created"].(string))
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now(), created, time.Minute)
+
+	status, unsealed, _ := runCLI(output, "--secret", password, "unseal")
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "hello", unsealed)
+	status, unsealed, _ = runCLI(env["sealed"].(string), "--secret", password, "unseal")
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "hello", unsealed)
+
+	status, _, stderr := runCLI(`{"v":2,"sealed":"x"}`, "--secret", password, "unseal")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "unsupported envelope version 2")
+	status, _, stderr = runCLI(`{"v":`, "--secret", password, "unseal")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "invalid envelope")
+}
+
+func TestVerifies(t *testing.T) {
+	status, sealed, _ := runCLI("hello", "--secret", password, "seal")
+	assert.Equal(t, 0, status)
+
+	status, output, stderr := runCLI(sealed, "--secret", password, "verify")
+	assert.Equal(t, 0, status)
+	assert.Empty(t, output)
+	assert.Empty(t, stderr)
+
+	status, output, stderr = runCLI(sealed[:len(sealed)-1]+"A", "--secret", password, "verify")
+	assert.Equal(t, 1, status)
+	assert.Empty(t, output)
+	assert.Equal(t, "invalid: Bad hmac value\n", stderr)
+
+	// A cookie which expired in 2013, with a valid HMAC.
+	base := "Fe26.2**a38dc7a7bf2f8ff650b103d8c669d76ad219527fbfff3d98e3b30bbecbe9bd3b*nTsatb7AQE1t0uMXDx-2aw*uIO5bRFTwEBlPC1Nd_hfSkZfqxkxuY1EO2Be_jJPNQCqFNumRBjQAl8WIKBW1beF*1380495854060"
+	h, err := iron.New(iron.Options{Secret: []byte(password)}).IntegrityHasher([]byte("hmacsalt"))
+	assert.Nil(t, err)
+	io.WriteString(h, base)
+	expired := base + "*hmacsalt*" + base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+	status, output, stderr = runCLI(expired, "--secret", password, "verify")
+	assert.Equal(t, 3, status)
+	assert.Empty(t, output)
+	assert.True(t, strings.HasPrefix(stderr, "expired: "))
+}
+
+func TestGeneratesSecrets(t *testing.T) {
+	status, first, _ := runCLI("", "gen-secret")
+	assert.Equal(t, 0, status)
+	secret, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(first))
+	assert.Nil(t, err)
+	assert.Len(t, secret, 32)
+
+	status, second, _ := runCLI("", "gen-secret")
+	assert.Equal(t, 0, status)
+	assert.NotEqual(t, first, second)
+
+	status, output, _ := runCLI("", "gen-secret", "--bytes", "64")
+	assert.Equal(t, 0, status)
+	secret, err = base64.RawURLEncoding.DecodeString(strings.TrimSpace(output))
+	assert.Nil(t, err)
+	assert.Len(t, secret, 64)
+
+	status, _, stderr := runCLI("", "gen-secret", "--bytes", "16")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "may not be less than 32 bytes")
+}
+
+func TestInspects(t *testing.T) {
+	ticket := "Fe26.2**0cdd607945dd1dffb7da0b0bf5f1a7daa6218cbae14cac51dcbd91fb077aeb5b*aOZLCKLhCt0D5IU1qLTtYw*g0ilNDlQ3TsdFUqJCqAm9iL7Wa60H7eYcHL_5oP136TOJREkS3BzheDC1dlxz5oJ**05b8943049af490e913bbc3a2485bee2aaf7b823f4c41d0ff0b7c168371a3772*R8yscVdTBRMdsoVbdDiFmUL8zb-c3PQLGJn4Y8C-AqI"
+	status, output, _ := runCLI(ticket, "inspect")
+	assert.Equal(t, 0, status)
+
+	var fields map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(output), &fields))
+	assert.Equal(t, map[string]interface{}{
+		"prefix":         "Fe26.2",
+		"passwordId":     "",
+		"saltLength":     float64(64),
+		"iv":             "68e64b08a2e10add03e48535a8b4ed63",
+		"bodyLength":     float64(48),
+		"hmacSaltLength": float64(64),
+		"hmac":           "47ccac71575305131db2855b7438859942fccdbf9cdcf40b1899f863c0be02a2",
+
+		"parametersEmbedded": false,
+	}, fields)
+
+	v := iron.New(iron.Options{Secret: []byte(password), TTL: time.Hour})
+	sealed, err := v.Seal([]byte("hello"))
+	assert.Nil(t, err)
+	status, output, _ = runCLI(sealed, "inspect")
+	assert.Equal(t, 0, status)
+	assert.Nil(t, json.Unmarshal([]byte(output), &fields))
+	expiration, err := time.Parse(time.RFC3339, fields["expiration"].(string))
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiration, time.Minute)
+
+	sealed, err = iron.New(iron.Options{Secret: []byte(password), EmbedParameters: true}).Seal([]byte("hello"))
+	assert.Nil(t, err)
+	status, output, _ = runCLI(sealed, "inspect")
+	assert.Equal(t, 0, status)
+	fields = nil
+	assert.Nil(t, json.Unmarshal([]byte(output), &fields))
+	assert.Equal(t, true, fields["parametersEmbedded"])
+	assert.Equal(t, "aes-256-cbc", fields["cipher"])
+	assert.Equal(t, "sha256", fields["hash"])
+
+	status, _, stderr := runCLI("not a cookie", "inspect")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "Incorrect number of sealed components")
+}
+
+func TestChecksExpirationAtTime(t *testing.T) {
+	v := iron.New(iron.Options{Secret: []byte(password), TTL: time.Hour})
+	sealed, err := v.Seal([]byte("hello"))
+	assert.Nil(t, err)
+
+	before := time.Now().Add(30 * time.Minute).Format(time.RFC3339)
+	status, unsealed, _ := runCLI(sealed, "--secret", password, "--now", before, "unseal")
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "hello", unsealed)
+
+	after := time.Now().Add(3 * time.Hour).Format(time.RFC3339)
+	status, _, stderr := runCLI(sealed, "--secret", password, "--now", after, "unseal")
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr, "Expired")
+	status, _, _ = runCLI(sealed, "--secret", password, "--now", after, "verify")
+	assert.Equal(t, 3, status)
+
+	status, _, stderr = runCLI(sealed, "--secret", password, "--now", "tomorrow", "unseal")
+	assert.Equal(t, 2, status)
+	assert.Contains(t, stderr, "invalid --now")
+}
+
+// timings parses the durations reported by --timing.
+func timings(t *testing.T, stderr string) (derivation, total time.Duration) {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	if !assert.Len(t, lines, 2) {
+		return 0, 0
+	}
+	derivation, err := time.ParseDuration(strings.TrimPrefix(lines[0], "derivation: "))
+	assert.Nil(t, err)
+	total, err = time.ParseDuration(strings.TrimPrefix(lines[1], "total: "))
+	assert.Nil(t, err)
+	return derivation, total
+}
+
+func TestReportsTiming(t *testing.T) {
+	status, sealed, stderr := runCLI("hello", "--secret", password, "--timing", "seal")
+	assert.Equal(t, 0, status)
+	fast, _ := timings(t, stderr)
+
+	status, unsealed, stderr := runCLI(sealed, "--secret", password, "--timing", "unseal")
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "hello", unsealed)
+	timings(t, stderr)
+
+	status, _, stderr = runCLI("hello", "--secret", password, "--timing", "--iterations", "200000", "seal")
+	assert.Equal(t, 0, status)
+	slow, total := timings(t, stderr)
+	assert.True(t, slow > fast, "%s should exceed %s", slow, fast)
+	assert.True(t, total > fast)
+}
+
+func TestReadsSecretFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(password+"\n"), 0600))
+
+	status, sealed, _ := runCLI("hello", "--secret-file", path, "seal")
+	assert.Equal(t, 0, status)
+	status, unsealed, _ := runCLI(sealed, "--secret", password, "unseal")
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "hello", unsealed)
+
+	status, _, stderr := runCLI(sealed, "--secret-file", path, "--secret", password, "unseal")
+	assert.Equal(t, 2, status)
+	assert.Contains(t, stderr, "may not be used with")
+
+	t.Setenv("IRON_SECRET", password)
+	status, _, stderr = runCLI(sealed, "--secret-file", path, "unseal")
+	assert.Equal(t, 2, status)
+	assert.Contains(t, stderr, "may not be used with")
+	status, unsealed, _ = runCLI(sealed, "unseal")
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "hello", unsealed)
+	t.Setenv("IRON_SECRET", "")
+
+	status, _, stderr = runCLI(sealed, "--secret-file", filepath.Join(dir, "missing"), "unseal")
+	assert.Equal(t, 2, status)
+	assert.Contains(t, stderr, "no such file")
+
+	empty := filepath.Join(dir, "empty")
+	assert.Nil(t, ioutil.WriteFile(empty, []byte("\n"), 0600))
+	status, _, stderr = runCLI(sealed, "--secret-file", empty, "unseal")
+	assert.Equal(t, 2, status)
+	assert.Contains(t, stderr, "is empty")
+
+	status, _, stderr = runCLI(sealed, "unseal")
+	assert.Equal(t, 2, status)
+	assert.Contains(t, stderr, "is required")
+}
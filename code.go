@@ -0,0 +1,90 @@
+package iron
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// maxCodeDigits is the most digits a code can have, since it's reduced from
+// a 31-bit integer.
+const maxCodeDigits = 9
+
+// ErrCodeDigits is returned from Code when the number of digits is out of
+// range.
+var ErrCodeDigits = errors.New("iron-go: code must have between 1 and 9 digits")
+
+// Code verifies the cookie like Verify, and returns a short numeric code
+// bound to it, such as to email to a user who must enter it to continue.
+// The code is the given number of decimal digits, zero-padded, reduced
+// from an HMAC of the cookie under a key derived from the integrity secret
+// like an integrity key, so it's stable for the cookie, and reveals no
+// more about the secret than the cookie's own HMAC. Short codes are
+// guessable, so callers should limit attempts.
+func (v *Vault) Code(sealed string, digits int) (string, error) {
+	if digits < 1 || digits > maxCodeDigits {
+		return "", ErrCodeDigits
+	}
+	_, v, err := v.verify(sealed, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return v.code(sealed, digits)
+}
+
+// VerifyCode reports whether the code is the one Code returns for the
+// cookie with the given number of digits, which should be fixed by the
+// caller rather than taken from the code, so that a shorter code can't be
+// guessed more easily. It returns false if the cookie is invalid.
+func (v *Vault) VerifyCode(sealed, code string, digits int) bool {
+	if len(code) != digits {
+		return false
+	}
+	expected, err := v.Code(sealed, digits)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal([]byte(expected), []byte(code))
+}
+
+// labelKey derives a 256-bit key for the label from the integrity secret,
+// or the secret if that's unset, just as an integrity key is derived for a
+// salt: stretched by PBKDF2 with Integrity.Iterations, or split from a raw
+// key by HKDF, so that values keyed with it are no quicker to brute-force
+// than the cookie's HMAC. The label stands in for the salt, and for the
+// HKDF info string, so each label's key is distinct.
+func (v *Vault) labelKey(label string) ([]byte, error) {
+	if v.opts.IntegritySecret != nil {
+		c := *v
+		c.opts.Secret = v.opts.IntegritySecret
+		v = &c
+	}
+
+	return v.generateKey(keyRole(label), 256, v.opts.Integrity.Iterations, []byte(label))
+}
+
+// code returns the code for the sealed cookie under the vault's secret,
+// truncating the HMAC as HOTP (RFC 4226) does.
+func (v *Vault) code(sealed string, digits int) (string, error) {
+	key, err := v.labelKey("iron-go code")
+	if err != nil {
+		return "", err
+	}
+
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(sealed))
+	sum := h.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, n%mod), nil
+}
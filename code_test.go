@@ -0,0 +1,74 @@
+package iron
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestDerivesVerificationCode(t *testing.T) {
+	v := New(Options{Secret: password})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	code, err := v.Code(cookie, 6)
+	assert.Nil(t, err)
+	assert.Len(t, code, 6)
+	assert.Regexp(t, "^[0-9]{6}$", code)
+	again, err := v.Code(cookie, 6)
+	assert.Nil(t, err)
+	assert.Equal(t, code, again)
+
+	assert.True(t, v.VerifyCode(cookie, code, 6))
+	wrong := []byte(code)
+	wrong[0] = '0' + (wrong[0]-'0'+1)%10
+	assert.False(t, v.VerifyCode(cookie, string(wrong), 6))
+	assert.False(t, v.VerifyCode(cookie, "", 6))
+	assert.False(t, v.VerifyCode(cookie, "", 0))
+	assert.False(t, v.VerifyCode(cookie, code[:1], 6))
+	assert.False(t, New(Options{Secret: rawKey}).VerifyCode(cookie, code, 6))
+
+	other, err := v.Seal(source)
+	assert.Nil(t, err)
+	otherCode, err := v.Code(other, 9)
+	assert.Nil(t, err)
+	assert.Len(t, otherCode, 9)
+
+	_, err = v.Code(cookie, 0)
+	assert.Equal(t, ErrCodeDigits, err)
+	_, err = v.Code(cookie, 10)
+	assert.Equal(t, ErrCodeDigits, err)
+	_, err = New(Options{Secret: rawKey}).Code(cookie, 6)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestStretchesCodeKey(t *testing.T) {
+	v := New(Options{Secret: password, Integrity: &Integrity{Hash: sha256.New, KeyBits: 256, Iterations: 2, SaltBits: 32}})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	code, err := v.Code(cookie, 9)
+	assert.Nil(t, err)
+
+	key := pbkdf2.Key(password, []byte("iron-go code"), 2, 32, sha1.New)
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(cookie))
+	sum := h.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	assert.Equal(t, fmt.Sprintf("%09d", n%1000000000), code)
+
+	split := New(Options{Secret: password, IntegritySecret: rawKey})
+	cookie, err = split.Seal(source)
+	assert.Nil(t, err)
+	code, err = split.Code(cookie, 9)
+	assert.Nil(t, err)
+	other, err := New(Options{Secret: password, IntegritySecret: password}).code(cookie, 9)
+	assert.Nil(t, err)
+	assert.NotEqual(t, code, other)
+}
@@ -0,0 +1,88 @@
+package iron
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+)
+
+// Compression selects whether payloads are compressed before encryption.
+type Compression int
+
+const (
+	// CompressionNone never compresses payloads. It's the default.
+	CompressionNone Compression = iota
+	// CompressionAlways deflates every payload. Cookies sealed with it can't
+	// be read by Node Iron.
+	CompressionAlways
+	// CompressionAuto deflates payloads only when that makes them smaller,
+	// so a cookie is never larger than it would be uncompressed, besides
+	// the component marking it as compressed. Cookies which aren't
+	// compressed can still be read by Node Iron.
+	CompressionAuto
+)
+
+// compress returns the payload to encrypt, deflating it and marking the
+// message as compressed if the options call for it.
+func (v *Vault) compress(msg *message, b []byte) ([]byte, error) {
+	if v.opts.Compression == CompressionNone {
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	if v.opts.Compression == CompressionAuto && buf.Len() >= len(b) {
+		return b, nil
+	}
+
+	msg.Compressed = true
+	return buf.Bytes(), nil
+}
+
+// decompress returns the payload of the message, inflating it if it was
+// compressed. It returns an UnsealError if the payload can't be inflated,
+// and ErrPayloadTooLarge if it inflates to more than max bytes, if max is
+// positive.
+func decompress(msg *message, b []byte, max int) ([]byte, error) {
+	if !msg.Compressed {
+		return b, nil
+	}
+
+	payload, err := readAllLimited(flate.NewReader(bytes.NewReader(b)), max)
+	if err == ErrPayloadTooLarge {
+		return nil, err
+	} else if err != nil {
+		return nil, UnsealError{"Invalid compressed payload"}
+	}
+
+	return payload, nil
+}
+
+// readAllLimited reads r to EOF like ioutil.ReadAll, but returns
+// ErrPayloadTooLarge rather than reading more than max bytes, if max is
+// positive, so that a small payload can't inflate without bound.
+func readAllLimited(r io.Reader, max int) ([]byte, error) {
+	if max <= 0 {
+		return ioutil.ReadAll(r)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > max {
+		return nil, ErrPayloadTooLarge
+	}
+	return b, nil
+}
@@ -0,0 +1,68 @@
+package iron
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressesOnlyWhenSmaller(t *testing.T) {
+	v := New(Options{Secret: password, Compression: CompressionAuto})
+	plain := New(Options{Secret: password})
+
+	compressible := bytes.Repeat([]byte(`{"a":1,"b":2}`), 100)
+	cookie, err := v.Seal(compressible)
+	assert.Nil(t, err)
+	assert.Contains(t, cookie, "*cmp=deflate*")
+	uncompressed, err := plain.Seal(compressible)
+	assert.Nil(t, err)
+	assert.True(t, len(cookie) < len(uncompressed))
+
+	payload, err := plain.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, compressible, payload)
+	size, err := v.PayloadSize(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, len(compressible), size)
+
+	random := make([]byte, 256)
+	_, err = rand.Read(random)
+	assert.Nil(t, err)
+	cookie, err = v.Seal(random)
+	assert.Nil(t, err)
+	assert.NotContains(t, cookie, "cmp=")
+	uncompressed, err = plain.Seal(random)
+	assert.Nil(t, err)
+	assert.Equal(t, len(uncompressed), len(cookie))
+
+	payload, err = v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, random, payload)
+}
+
+func TestCompressesAlways(t *testing.T) {
+	v := New(Options{Secret: password, Compression: CompressionAlways})
+	cookie, err := v.Seal([]byte("a"))
+	assert.Nil(t, err)
+	assert.Contains(t, cookie, "*cmp=deflate*")
+
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), payload)
+}
+
+func TestBoundsDecompressedPayload(t *testing.T) {
+	payload := bytes.Repeat([]byte{'x'}, 1<<20)
+	cookie, err := New(Options{Secret: password, Compression: CompressionAlways, MaxPlaintextSize: -1}).Seal(payload)
+	assert.Nil(t, err)
+	assert.True(t, len(cookie) < 4096)
+
+	_, err = New(Options{Secret: password, MaxPlaintextSize: len(payload) - 1}).Unseal(cookie)
+	assert.Equal(t, ErrPayloadTooLarge, err)
+
+	unsealed, err := New(Options{Secret: password, MaxPlaintextSize: len(payload)}).Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, unsealed)
+}
@@ -0,0 +1,125 @@
+package iron
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"strings"
+)
+
+// ConfigError is returned from NewChecked if the options are invalid or
+// incoherent.
+type ConfigError struct{ message string }
+
+// Error implements error.Error
+func (c ConfigError) Error() string { return c.message }
+
+// NewChecked creates a new Vault like New, but returns a ConfigError rather
+// than panicking if the options are invalid. It additionally verifies that
+// the encryption key and IV sizes are accepted by the configured cipher,
+// which New leaves to fail when sealing.
+func NewChecked(options Options) (*Vault, error) {
+	if len(options.Secret) < 32 && options.Secrets == nil && !options.verifyOnly() {
+		return nil, ConfigError{"Secret may not be less than 32 bytes"}
+	}
+	if options.IntegritySecret != nil && len(options.IntegritySecret) < 32 {
+		return nil, ConfigError{"IntegritySecret may not be less than 32 bytes"}
+	}
+	if options.IntegritySecret != nil && options.Secrets != nil {
+		return nil, ConfigError{"IntegritySecret is not supported with Secrets"}
+	}
+	if options.FastReject && options.Secrets != nil {
+		return nil, ConfigError{"FastReject does not support Secrets"}
+	}
+	if options.Base64Alphabet != "" {
+		if problem := checkBase64Alphabet(options.Base64Alphabet); problem != "" {
+			return nil, ConfigError{problem}
+		}
+	}
+
+	opts := options.fillDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return newVault(opts), nil
+}
+
+// validate checks that the filled-in options are coherent.
+func (o Options) validate() error {
+	if o.Encryption.Cipher == nil {
+		return ConfigError{"Encryption.Cipher is required"}
+	}
+	if o.Integrity.Hash == nil {
+		return ConfigError{"Integrity.Hash is required"}
+	}
+	if o.Integrity.KeyBits == 0 || o.Integrity.KeyBits%8 != 0 {
+		return ConfigError{fmt.Sprintf("Integrity.KeyBits %d must be a positive multiple of 8", o.Integrity.KeyBits)}
+	}
+	if strings.Contains(o.MACFormatVersion, delimiter) {
+		return ConfigError{"MACFormatVersion may not contain separators"}
+	}
+	if o.Encryption.KeyBits%8 != 0 {
+		return ConfigError{fmt.Sprintf("Encryption.KeyBits %d must be a multiple of 8", o.Encryption.KeyBits)}
+	}
+	if o.RawKey && (o.Secret != nil && len(o.Secret) != rawKeySize ||
+		o.IntegritySecret != nil && len(o.IntegritySecret) != rawKeySize) {
+		return ErrRawKeyLength
+	}
+	if o.SealRetries < 0 {
+		return ConfigError{"SealRetries may not be negative"}
+	}
+	if o.Encryption.DerivedKeyBytes < 0 {
+		return ConfigError{"Encryption.DerivedKeyBytes may not be negative"}
+	}
+	if err := checkTransformers(o.Transformers); err != nil {
+		return err
+	}
+
+	return o.Encryption.probeCipher()
+}
+
+// probeCipher checks KeyBits against a registered cipher's key size, and
+// constructs the cipher with a key and IV of the configured sizes,
+// returning a ConfigError if the cipher rejects either.
+func (e *Encryption) probeCipher() (err error) {
+	if bits, ok := cipherKeyBits[cipherName(e.Cipher)]; ok {
+		if e.KeyBits != bits {
+			return ConfigError{fmt.Sprintf("Encryption.KeyBits %d does not match the cipher's %d-bit key", e.KeyBits, bits)}
+		}
+		// The built-in ciphers use only the prefix of a longer key, but a
+		// shorter one, or another AES key size, would change the cipher.
+		if n := e.DerivedKeyBytes; n > 0 && n != int(bits/8) && (n < int(bits/8) || validAESKeySize(n)) {
+			return ConfigError{fmt.Sprintf("Encryption.DerivedKeyBytes %d does not match the cipher's %d-bit key", n, bits)}
+		}
+	}
+
+	key := make([]byte, e.derivedKeyBits()/8)
+	iv := make([]byte, e.IVBits)
+
+	var encrypt cipher.BlockMode
+	func() {
+		// Block modes panic, rather than erroring, on an IV whose length
+		// isn't the cipher's block size.
+		defer func() {
+			if recover() != nil {
+				err = ConfigError{fmt.Sprintf("Encryption.IVBits %d does not match the cipher's block size", e.IVBits)}
+			}
+		}()
+		encrypt, _, err = e.Cipher(key, iv)
+	}()
+
+	if _, ok := err.(ConfigError); ok {
+		return err
+	}
+	if err != nil && e.DerivedKeyBytes > 0 {
+		return ConfigError{fmt.Sprintf("Encryption.DerivedKeyBytes %d does not match the cipher: %s", e.DerivedKeyBytes, err)}
+	}
+	if err != nil {
+		return ConfigError{fmt.Sprintf("Encryption.KeyBits %d does not match the cipher: %s", e.KeyBits, err)}
+	}
+	if encrypt.BlockSize() != len(iv) {
+		return ConfigError{fmt.Sprintf("Encryption.IVBits %d does not match the cipher's block size %d", e.IVBits, encrypt.BlockSize())}
+	}
+
+	return nil
+}
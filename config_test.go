@@ -0,0 +1,78 @@
+package iron
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCheckedAcceptsCoherentOptions(t *testing.T) {
+	v, err := NewChecked(Options{Secret: password})
+	assert.Nil(t, err)
+	assert.NotNil(t, v)
+
+	v, err = NewChecked(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 128, Iterations: 1, SaltBits: 32, Cipher: AES128,
+	}})
+	assert.Nil(t, err)
+	assert.NotNil(t, v)
+}
+
+func TestNewCheckedRejectsIncoherentOptions(t *testing.T) {
+	integrity := &Integrity{Hash: sha256.New, KeyBits: 256, Iterations: 1, SaltBits: 32}
+	tt := []struct {
+		opts Options
+		err  ConfigError
+	}{
+		{
+			Options{Secret: []byte("hi")},
+			ConfigError{"Secret may not be less than 32 bytes"},
+		},
+		{
+			Options{Secret: password, Encryption: &Encryption{IVBits: 16, KeyBits: 128, Iterations: 1, SaltBits: 32, Cipher: AES256}},
+			ConfigError{"Encryption.KeyBits 128 does not match the cipher's 256-bit key"},
+		},
+		{
+			Options{Secret: password, Encryption: &Encryption{IVBits: 16, KeyBits: 256, Iterations: 1, SaltBits: 32, Cipher: AES128}},
+			ConfigError{"Encryption.KeyBits 256 does not match the cipher's 128-bit key"},
+		},
+		{
+			Options{Secret: password, Encryption: &Encryption{IVBits: 8, KeyBits: 256, Iterations: 1, SaltBits: 32, Cipher: AES256}},
+			ConfigError{"Encryption.IVBits 8 does not match the cipher's block size"},
+		},
+		{
+			Options{Secret: password, Encryption: &Encryption{IVBits: 16, KeyBits: 256, Iterations: 1, SaltBits: 32}},
+			ConfigError{"Encryption.Cipher is required"},
+		},
+		{
+			Options{Secret: password, Integrity: &Integrity{KeyBits: 256, Iterations: 1, SaltBits: 32}},
+			ConfigError{"Integrity.Hash is required"},
+		},
+		{
+			Options{Secret: password, Integrity: &Integrity{Hash: sha256.New, KeyBits: 0, Iterations: 1, SaltBits: 32}},
+			ConfigError{"Integrity.KeyBits 0 must be a positive multiple of 8"},
+		},
+	}
+
+	for _, test := range tt {
+		if test.opts.Integrity == nil {
+			test.opts.Integrity = integrity
+		}
+		_, err := NewChecked(test.opts)
+		assert.Equal(t, test.err, err)
+	}
+}
+
+func TestBuiltInCiphersAcceptLegacyKeySizes(t *testing.T) {
+	for _, keyBits := range []uint{128, 192} {
+		v := New(Options{Secret: password, Encryption: &Encryption{
+			IVBits: 16, KeyBits: keyBits, Iterations: 1, SaltBits: 32, Cipher: AES256,
+		}})
+		cookie, err := v.Seal(source)
+		assert.Nil(t, err)
+		payload, err := v.Unseal(cookie)
+		assert.Nil(t, err)
+		assert.Equal(t, source, payload)
+	}
+}
@@ -0,0 +1,188 @@
+package iron
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+)
+
+// connNonceSize is the length of the nonce each peer of a wrapped
+// connection sends when it starts.
+const connNonceSize = 16
+
+// connLabel begins the additional data each stream key of a wrapped
+// connection is sealed with.
+const connLabel = "iron-go conn"
+
+// WrapConn returns a connection which encrypts and authenticates everything
+// written to conn, and verifies and decrypts everything read from it, for
+// peers which share the vault's secret. On first use, each peer sends a
+// random nonce and reads the other's. Each direction then starts with a
+// random stream key sealed with the vault, as in SealStream, bound to the
+// sender's and receiver's nonces in that order, so that a stream can't be
+// replayed on another connection or reflected back to its sender. Each
+// Write is sent as frames of up to 64 KiB, each with a fresh IV and its own
+// HMAC. Frames are numbered, so a reordered, replayed or dropped frame
+// fails to verify; with Options.ConnSequenceNumbers it's reported as "Frame
+// sequence error". Close sends a final frame before closing conn, so that
+// the peer reads io.EOF only if the connection wasn't truncated.
+func (v *Vault) WrapConn(conn net.Conn) net.Conn {
+	return &sealedConn{Conn: conn, v: v}
+}
+
+// sealedConn is a connection wrapped by WrapConn.
+type sealedConn struct {
+	net.Conn
+	v *Vault
+
+	// hmu guards the nonces, exchanged by the first Read or Write, and
+	// the error if that failed.
+	hmu       sync.Mutex
+	nonce     []byte
+	peerNonce []byte
+	herr      error
+
+	wmu sync.Mutex
+	w   *frameWriter
+
+	rmu     sync.Mutex
+	r       *frameReader
+	pending []byte
+	eof     bool
+}
+
+// Write sends b as one or more frames.
+func (c *sealedConn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.startWriting(); err != nil {
+		return 0, err
+	}
+
+	for n := 0; n < len(b); {
+		chunk := b[n:]
+		if len(chunk) > streamChunkSize {
+			chunk = chunk[:streamChunkSize]
+		}
+		if err := c.w.write(0, chunk); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+	}
+
+	return len(b), nil
+}
+
+// handshake sends this peer's nonce and reads the other's, if that hasn't
+// been tried, returning the error if it failed.
+func (c *sealedConn) handshake() error {
+	c.hmu.Lock()
+	defer c.hmu.Unlock()
+	if c.peerNonce == nil && c.herr == nil {
+		c.herr = c.exchangeNonces()
+	}
+
+	return c.herr
+}
+
+// exchangeNonces sends a fresh nonce and reads the peer's. The nonce is
+// written concurrently with the read, since neither peer may otherwise
+// read until the other has.
+func (c *sealedConn) exchangeNonces() error {
+	nonce, err := c.v.randomBytes(connNonceSize)
+	if err != nil {
+		return err
+	}
+	written := make(chan error, 1)
+	go func() {
+		_, err := c.Conn.Write(nonce)
+		written <- err
+	}()
+	peerNonce := make([]byte, connNonceSize)
+	if _, err := io.ReadFull(c.Conn, peerNonce); err != nil {
+		return UnsealError{"Truncated stream"}
+	}
+	if err := <-written; err != nil {
+		return err
+	}
+	if bytes.Equal(nonce, peerNonce) {
+		return UnsealError{"Reflected connection nonce"}
+	}
+
+	c.nonce, c.peerNonce = nonce, peerNonce
+	return nil
+}
+
+// streamAAD returns the additional data for the stream key sent from the
+// peer with the first nonce to the peer with the second.
+func streamAAD(from, to []byte) []byte {
+	aad := append([]byte(connLabel), from...)
+	return append(aad, to...)
+}
+
+// startWriting sends the stream key, if it hasn't been sent.
+func (c *sealedConn) startWriting() error {
+	if c.w != nil {
+		return nil
+	}
+	if err := c.handshake(); err != nil {
+		return err
+	}
+	key, err := c.v.writeStreamKey(c.Conn, streamAAD(c.nonce, c.peerNonce))
+	if err != nil {
+		return err
+	}
+
+	c.w = &frameWriter{v: c.v, w: c.Conn, key: key, sequenced: c.v.opts.ConnSequenceNumbers}
+	return nil
+}
+
+// Read reads plaintext from the frames received. It returns io.EOF after
+// the peer's final frame, and an UnsealError if any frame is invalid.
+func (c *sealedConn) Read(b []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	for len(c.pending) == 0 {
+		if c.eof {
+			return 0, io.EOF
+		}
+		if c.r == nil {
+			if err := c.handshake(); err != nil {
+				return 0, err
+			}
+			key, err := c.v.readStreamKey(c.Conn, streamAAD(c.peerNonce, c.nonce))
+			if err != nil {
+				return 0, err
+			}
+			c.r = &frameReader{r: c.Conn, key: key, sequenced: c.v.opts.ConnSequenceNumbers}
+		}
+
+		flags, plaintext, err := c.r.read(streamChunkSize)
+		if err != nil {
+			return 0, err
+		}
+		c.pending = plaintext
+		c.eof = flags&frameFinal != 0
+	}
+
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Close sends the final frame and closes the connection.
+func (c *sealedConn) Close() error {
+	c.wmu.Lock()
+	err := c.startWriting()
+	if err == nil {
+		err = c.w.write(frameFinal, nil)
+	}
+	c.wmu.Unlock()
+
+	if closeErr := c.Conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
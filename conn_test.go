@@ -0,0 +1,203 @@
+package iron
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// peerNonce is the nonce the peer of a recordingConn sends.
+var peerNonce = bytes.Repeat([]byte{'p'}, connNonceSize)
+
+// recordingConn records what's written to it, and reads peerNonce.
+type recordingConn struct {
+	net.Conn
+	buf  bytes.Buffer
+	peer *bytes.Reader
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) { return c.peer.Read(b) }
+
+func (c *recordingConn) Write(b []byte) (int, error) { return c.buf.Write(b) }
+
+func (c *recordingConn) Close() error { return nil }
+
+// captureConn returns the nonce, stream key header and frames a wrapped
+// connection sends to a peer sending peerNonce for the writes, followed by
+// its final frame.
+func captureConn(t *testing.T, v *Vault, sequenced bool, writes ...string) ([]byte, []byte, [][]byte) {
+	rec := &recordingConn{peer: bytes.NewReader(peerNonce)}
+	conn := v.WrapConn(rec)
+	for _, w := range writes {
+		_, err := conn.Write([]byte(w))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, conn.Close())
+
+	stream := rec.buf.Bytes()
+	nonce, stream := stream[:connNonceSize], stream[connNonceSize:]
+	n := 4 + int(binary.BigEndian.Uint32(stream))
+	header, rest := stream[:n], stream[n:]
+
+	prefix := 5
+	if sequenced {
+		prefix += sequenceSize
+	}
+	var frames [][]byte
+	for len(rest) > 0 {
+		n := prefix + int(binary.BigEndian.Uint32(rest))
+		if !assert.True(t, n <= len(rest)) {
+			break
+		}
+		frames = append(frames, rest[:n])
+		rest = rest[n:]
+	}
+
+	return nonce, header, frames
+}
+
+// readConn feeds the nonce, header and frames to a connection wrapped with
+// the options over a pipe, and returns what it reads. The wrapped
+// connection's own nonce is drawn from rand.
+func readConn(opts Options, rand io.Reader, nonce, header []byte, frames [][]byte) (string, error) {
+	opts.Rand = rand
+	client, server := net.Pipe()
+	go func() {
+		client.Write(nonce)
+		io.ReadFull(client, make([]byte, connNonceSize))
+		client.Write(header)
+		for _, frame := range frames {
+			client.Write(frame)
+		}
+		client.Close()
+	}()
+
+	defer server.Close()
+	data, err := io.ReadAll(New(opts).WrapConn(server))
+	return string(data), err
+}
+
+// replayConn feeds a captured stream to a connection wrapped with the
+// options which sends peerNonce, as the peer it was captured from did.
+func replayConn(opts Options, nonce, header []byte, frames [][]byte) (string, error) {
+	return readConn(opts, bytes.NewReader(peerNonce), nonce, header, frames)
+}
+
+func TestWrapConnDeliversInOrder(t *testing.T) {
+	for _, sequenced := range []bool{false, true} {
+		v := New(Options{Secret: password, ConnSequenceNumbers: sequenced})
+		client, server := net.Pipe()
+
+		done := make(chan error)
+		go func() {
+			conn := v.WrapConn(client)
+			for _, w := range []string{"hello ", "world", string(bytes.Repeat([]byte{'x'}, streamChunkSize+1))} {
+				if _, err := conn.Write([]byte(w)); err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- conn.Close()
+		}()
+
+		conn := v.WrapConn(server)
+		data, err := io.ReadAll(conn)
+		assert.Nil(t, err)
+		assert.Nil(t, <-done)
+		assert.Equal(t, "hello world"+string(bytes.Repeat([]byte{'x'}, streamChunkSize+1)), string(data))
+		server.Close()
+	}
+}
+
+func TestWrapConnUsesFreshIVs(t *testing.T) {
+	v := New(Options{Secret: password})
+	_, _, frames := captureConn(t, v, false, "same", "same")
+	assert.Len(t, frames, 3)
+	assert.NotEqual(t, frames[0][5:], frames[1][5:])
+}
+
+func TestWrapConnRejectsReorderedFrames(t *testing.T) {
+	opts := Options{Secret: password, ConnSequenceNumbers: true}
+	nonce, header, frames := captureConn(t, New(opts), true, "first", "second")
+
+	data, err := replayConn(opts, nonce, header, frames)
+	assert.Nil(t, err)
+	assert.Equal(t, "firstsecond", data)
+
+	_, err = replayConn(opts, nonce, header, [][]byte{frames[1], frames[0], frames[2]})
+	assert.Equal(t, UnsealError{"Frame sequence error"}, err)
+}
+
+func TestWrapConnRejectsDuplicatedFrames(t *testing.T) {
+	opts := Options{Secret: password, ConnSequenceNumbers: true}
+	nonce, header, frames := captureConn(t, New(opts), true, "first", "second")
+
+	_, err := replayConn(opts, nonce, header, [][]byte{frames[0], frames[0], frames[1], frames[2]})
+	assert.Equal(t, UnsealError{"Frame sequence error"}, err)
+}
+
+func TestWrapConnRejectsReplayWithoutSequenceNumbers(t *testing.T) {
+	opts := Options{Secret: password}
+	nonce, header, frames := captureConn(t, New(opts), false, "first", "second")
+
+	_, err := replayConn(opts, nonce, header, [][]byte{frames[0], frames[0], frames[1], frames[2]})
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestWrapConnRejectsTruncation(t *testing.T) {
+	opts := Options{Secret: password, ConnSequenceNumbers: true}
+	nonce, header, frames := captureConn(t, New(opts), true, "first")
+
+	_, err := replayConn(opts, nonce, header, frames[:1])
+	assert.NotNil(t, err)
+}
+
+func TestWrapConnRejectsReplayOnAnotherConnection(t *testing.T) {
+	opts := Options{Secret: password}
+	nonce, header, frames := captureConn(t, New(opts), false, "first")
+
+	_, err := readConn(opts, nil, nonce, header, frames)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestWrapConnRejectsReflectedStreams(t *testing.T) {
+	v := New(Options{Secret: password})
+
+	// The attacker reflects the client's nonce back to it, or else sends
+	// its own nonce and reflects the client's stream.
+	for _, reflectNonce := range []bool{true, false} {
+		client, server := net.Pipe()
+		go func(reflectNonce bool) {
+			nonce := make([]byte, connNonceSize)
+			io.ReadFull(server, nonce)
+			if !reflectNonce {
+				nonce = peerNonce
+			}
+			server.Write(nonce)
+			if reflectNonce {
+				return
+			}
+			length := make([]byte, 4)
+			io.ReadFull(server, length)
+			header := make([]byte, binary.BigEndian.Uint32(length))
+			io.ReadFull(server, header)
+			server.Write(length)
+			server.Write(header)
+		}(reflectNonce)
+
+		conn := v.WrapConn(client)
+		if reflectNonce {
+			_, err := conn.Read(make([]byte, 5))
+			assert.Equal(t, UnsealError{"Reflected connection nonce"}, err)
+		} else {
+			go conn.Write([]byte("hello"))
+			_, err := conn.Read(make([]byte, 5))
+			assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+		}
+		server.Close()
+	}
+}
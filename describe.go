@@ -0,0 +1,64 @@
+package iron
+
+import "time"
+
+// VaultDescription summarizes the effective configuration of a vault, after
+// defaults are filled in. Ciphers and hashes are identified by the names
+// they're registered under with CipherByName and HashByName, or "custom" if
+// they aren't registered.
+type VaultDescription struct {
+	Cipher               string
+	EncryptionKeyBits    uint
+	EncryptionIterations uint
+	EncryptionSaltBits   uint
+	IVBits               uint
+	// DerivedKeyBytes is Encryption.DerivedKeyBytes, or zero if the key
+	// derived is EncryptionKeyBits long.
+	DerivedKeyBytes int
+
+	IntegrityHash       string
+	IntegrityKeyBits    uint
+	IntegrityIterations uint
+	IntegritySaltBits   uint
+
+	// PBKDF2Hash is the hash used to derive keys from the secret, or empty
+	// if the secret is used as a raw key.
+	PBKDF2Hash string
+
+	TTL           time.Duration
+	TimestampSkew time.Duration
+}
+
+// Describe returns a description of the vault's effective configuration,
+// without sealing anything.
+func (v *Vault) Describe() VaultDescription {
+	enc, integrity := v.opts.Encryption, v.opts.Integrity
+	d := VaultDescription{
+		Cipher:               describeName(cipherName(enc.Cipher)),
+		EncryptionKeyBits:    enc.KeyBits,
+		EncryptionIterations: enc.Iterations,
+		EncryptionSaltBits:   enc.SaltBits,
+		IVBits:               enc.IVBits,
+		DerivedKeyBytes:      enc.DerivedKeyBytes,
+		IntegrityHash:        describeName(hashName(integrity.Hash)),
+		IntegrityKeyBits:     integrity.KeyBits,
+		IntegrityIterations:  integrity.Iterations,
+		IntegritySaltBits:    integrity.SaltBits,
+		TTL:                  v.opts.TTL,
+		TimestampSkew:        v.opts.TimestampSkew,
+	}
+	if !v.opts.RawKey {
+		d.PBKDF2Hash = describeName(hashName(v.opts.PBKDF2Hash))
+	}
+
+	return d
+}
+
+// describeName returns the name, or "custom" for an unregistered one.
+func describeName(name string) string {
+	if name == "" {
+		return "custom"
+	}
+
+	return name
+}
@@ -0,0 +1,55 @@
+package iron
+
+import (
+	"crypto/cipher"
+	"crypto/sha512"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribesDefaults(t *testing.T) {
+	assert.Equal(t, VaultDescription{
+		Cipher:               "aes-256-cbc",
+		EncryptionKeyBits:    256,
+		EncryptionIterations: 1,
+		EncryptionSaltBits:   32,
+		IVBits:               16,
+		IntegrityHash:        "sha256",
+		IntegrityKeyBits:     256,
+		IntegrityIterations:  1,
+		IntegritySaltBits:    32,
+		PBKDF2Hash:           "sha1",
+		TimestampSkew:        time.Minute,
+	}, New(Options{Secret: password}).Describe())
+}
+
+func TestDescribesCustomConfig(t *testing.T) {
+	custom := CipherFactory(func(key, iv []byte) (cipher.BlockMode, cipher.BlockMode, error) {
+		return aesCBC(key, iv)
+	})
+	d := New(Options{
+		Secret:        rawKey,
+		RawKey:        true,
+		TTL:           time.Hour,
+		TimestampSkew: time.Second,
+		Encryption:    &Encryption{IVBits: 16, KeyBits: 128, Iterations: 2, SaltBits: 64, Cipher: custom, DerivedKeyBytes: 32},
+		Integrity:     &Integrity{Hash: sha512.New, KeyBits: 512, Iterations: 3, SaltBits: 128},
+	}).Describe()
+
+	assert.Equal(t, VaultDescription{
+		Cipher:               "custom",
+		EncryptionKeyBits:    128,
+		EncryptionIterations: 2,
+		EncryptionSaltBits:   64,
+		IVBits:               16,
+		DerivedKeyBytes:      32,
+		IntegrityHash:        "sha512",
+		IntegrityKeyBits:     512,
+		IntegrityIterations:  3,
+		IntegritySaltBits:    128,
+		TTL:                  time.Hour,
+		TimestampSkew:        time.Second,
+	}, d)
+}
@@ -0,0 +1,78 @@
+package iron
+
+import (
+	"math"
+	"time"
+)
+
+// DiagnosticAttempt is the outcome of verifying a cookie under one set of
+// encoding options.
+type DiagnosticAttempt struct {
+	Encoding EncodingOptions
+	// Err is the reason the cookie didn't verify, or nil if it did.
+	Err error
+}
+
+// DiagnosticReport is the result of Diagnose.
+type DiagnosticReport struct {
+	// Err is the ConfigError from building a vault with the secret, such as
+	// when it's too short, in which case no encodings were tried.
+	Err error
+	// Verified reports whether the cookie verified under any of the
+	// encodings tried.
+	Verified bool
+	// Suggested is the encoding the cookie verified under, which a vault
+	// should be configured with to unseal it.
+	Suggested EncodingOptions
+	// Expired reports whether the cookie verified but has expired.
+	Expired bool
+	// Attempts lists each encoding tried, in order.
+	Attempts []DiagnosticAttempt
+}
+
+// diagnosticAlphabets are the alphabets Diagnose tries for the salt, IV and
+// body components: base64url, and the standard alphabet which peers
+// sometimes use by mistake.
+var diagnosticAlphabets = []string{
+	"",
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/",
+}
+
+// Diagnose tries to verify the cookie with the secret and default
+// parameters under each combination of OmitPrefix, HMACEncoding and
+// Base64Alphabet, to help track down interoperability problems which
+// otherwise surface only as "Invalid component encoding" or "Bad hmac
+// value". Expiration is ignored while trying encodings, and reported
+// separately. It's intended for debugging, and derives keys for every
+// attempt.
+func Diagnose(sealed string, secret []byte) DiagnosticReport {
+	var report DiagnosticReport
+	for _, alphabet := range diagnosticAlphabets {
+		for _, omitPrefix := range []bool{false, true} {
+			for _, encoding := range []HMACEncoding{Base64URL, Base64Std, Hex} {
+				e := EncodingOptions{OmitPrefix: omitPrefix, HMACEncoding: encoding, Base64Alphabet: alphabet}
+				v, err := NewChecked(Options{
+					Secret:         secret,
+					OmitPrefix:     omitPrefix,
+					HMACEncoding:   encoding,
+					Base64Alphabet: alphabet,
+					TimestampSkew:  math.MaxInt64,
+				})
+				if err != nil {
+					report.Err = err
+					return report
+				}
+
+				msg, _, err := v.verify(sealed, nil)
+				report.Attempts = append(report.Attempts, DiagnosticAttempt{e, err})
+				if err == nil && !report.Verified {
+					report.Verified = true
+					report.Suggested = e
+					report.Expired = !msg.Expiration.IsZero() && msg.Expiration.Before(time.Now())
+				}
+			}
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,66 @@
+package iron
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnosesHMACEncoding(t *testing.T) {
+	for _, encoding := range []HMACEncoding{Base64URL, Base64Std, Hex} {
+		cookie, err := New(Options{Secret: password, HMACEncoding: encoding}).Seal(source)
+		assert.Nil(t, err)
+
+		report := Diagnose(cookie, password)
+		assert.True(t, report.Verified, encoding.String())
+		assert.Equal(t, EncodingOptions{HMACEncoding: encoding}, report.Suggested)
+		assert.False(t, report.Expired)
+		assert.Len(t, report.Attempts, 12)
+	}
+
+	cookie, err := New(Options{Secret: password, OmitPrefix: true, HMACEncoding: Base64Std}).Seal(source)
+	assert.Nil(t, err)
+	report := Diagnose(cookie, password)
+	assert.Equal(t, EncodingOptions{OmitPrefix: true, HMACEncoding: Base64Std}, report.Suggested)
+	assert.Equal(t, UnsealError{"Invalid component encoding"}, report.Attempts[3].Err)
+
+	expired, err := New(Options{Secret: password}).seal(&message{Expiration: time.Now().Add(-time.Hour)}, source)
+	assert.Nil(t, err)
+	report = Diagnose(expired, password)
+	assert.True(t, report.Verified)
+	assert.True(t, report.Expired)
+
+	report = Diagnose(cookie, rawKey)
+	assert.False(t, report.Verified)
+	for _, attempt := range report.Attempts {
+		assert.NotNil(t, attempt.Err)
+	}
+}
+
+func TestDiagnosesBodyAlphabet(t *testing.T) {
+	alphabet := diagnosticAlphabets[1]
+	vault := New(Options{Secret: password, Base64Alphabet: alphabet, HMACEncoding: Hex})
+	var cookie string
+	for !strings.ContainsAny(cookie, "+/") {
+		var err error
+		cookie, err = vault.Seal(source)
+		assert.Nil(t, err)
+	}
+
+	report := Diagnose(cookie, password)
+	assert.Nil(t, report.Err)
+	assert.True(t, report.Verified)
+	assert.Equal(t, EncodingOptions{HMACEncoding: Hex, Base64Alphabet: alphabet}, report.Suggested)
+}
+
+func TestDiagnosesShortSecret(t *testing.T) {
+	cookie, err := New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+
+	report := Diagnose(cookie, []byte("short"))
+	assert.Equal(t, ConfigError{"Secret may not be less than 32 bytes"}, report.Err)
+	assert.False(t, report.Verified)
+	assert.Empty(t, report.Attempts)
+}
@@ -0,0 +1,89 @@
+package iron
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// envelopePrefix starts envelope seals. They aren't Iron cookies, and can't
+// be unsealed with Unseal.
+var envelopePrefix = "Fe26.2-env"
+
+// SealEnvelope seals the payload with envelope encryption: the payload is
+// encrypted and authenticated under a fresh random content key, and only
+// that key is sealed with the vault, which acts as the key-encryption key.
+// The vault's secret can then be rotated with RewrapEnvelope, which reseals
+// the small content key without touching the body.
+func (v *Vault) SealEnvelope(b []byte) (string, error) {
+	key, content, err := v.encryptContent(b)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := v.sealKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	base := strings.Join(append([]string{envelopePrefix}, content...), delimiter)
+	return strings.Join([]string{
+		base,
+		base64.RawURLEncoding.EncodeToString([]byte(wrapped)),
+		base64.RawURLEncoding.EncodeToString(multiMAC(key, base)),
+	}, delimiter), nil
+}
+
+// UnsealEnvelope unseals a payload sealed by SealEnvelope. It returns an
+// UnsealError if the seal is invalid, or if its content key wasn't sealed
+// by this vault.
+func (v *Vault) UnsealEnvelope(sealed string) ([]byte, error) {
+	parts, key, err := v.unwrapEnvelope(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.Join(parts[:3], delimiter)
+	return decryptContent(key, parts[1], parts[2], base, parts[4])
+}
+
+// RewrapEnvelope unseals the content key of an envelope sealed by this
+// vault, and seals it again with the newKEK vault, leaving the encrypted
+// body as it is. The result can then only be unsealed by newKEK.
+func (v *Vault) RewrapEnvelope(sealed string, newKEK *Vault) (string, error) {
+	parts, key, err := v.unwrapEnvelope(sealed)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := newKEK.sealKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	parts[3] = base64.RawURLEncoding.EncodeToString([]byte(wrapped))
+	return strings.Join(parts, delimiter), nil
+}
+
+// unwrapEnvelope splits the envelope into its components and unseals its
+// content key.
+func (v *Vault) unwrapEnvelope(sealed string) ([]string, []byte, error) {
+	parts := strings.Split(sealed, delimiter)
+	if len(parts) != 5 {
+		return nil, nil, UnsealError{"Incorrect number of sealed components"}
+	}
+	if parts[0] != envelopePrefix {
+		return nil, nil, UnsealError{"Wrong mac prefix"}
+	}
+
+	var wrapped []byte
+	if err := base64decodeInto(&wrapped, parts[3]); err != nil {
+		return nil, nil, UnsealError{"Invalid component encoding"}
+	}
+	key, err := v.Unseal(string(wrapped))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(key) != multiKeySize {
+		return nil, nil, UnsealError{"Invalid content key"}
+	}
+
+	return parts, key, nil
+}
@@ -0,0 +1,47 @@
+package iron
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealsEnvelopes(t *testing.T) {
+	old := New(Options{Secret: password})
+	sealed, err := old.SealEnvelope(source)
+	assert.Nil(t, err)
+	payload, err := old.UnsealEnvelope(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = old.Unseal(sealed)
+	assert.NotNil(t, err)
+
+	parts := strings.Split(sealed, delimiter)
+	parts[2] = strings.Repeat("A", len(parts[2]))
+	_, err = old.UnsealEnvelope(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestRewrapsEnvelopes(t *testing.T) {
+	old := New(Options{Secret: password})
+	rotated := New(Options{Secret: rawKey})
+	sealed, err := old.SealEnvelope(source)
+	assert.Nil(t, err)
+
+	rewrapped, err := old.RewrapEnvelope(sealed, rotated)
+	assert.Nil(t, err)
+	before, after := strings.Split(sealed, delimiter), strings.Split(rewrapped, delimiter)
+	assert.Equal(t, before[:3], after[:3])
+	assert.Equal(t, before[4], after[4])
+	assert.NotEqual(t, before[3], after[3])
+
+	payload, err := rotated.UnsealEnvelope(rewrapped)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+	_, err = old.UnsealEnvelope(rewrapped)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+	_, err = rotated.RewrapEnvelope(sealed, old)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
@@ -0,0 +1,64 @@
+package iron
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// fastTagSize is the number of bytes of HMAC kept in the fast-reject tag.
+const fastTagSize = 12
+
+// fastRejectInfo distinguishes the fast-reject key from the vault's other
+// keys. It's the PBKDF2 salt, or the HKDF info for raw keys.
+const fastRejectInfo = "iron-go fast-reject"
+
+// fastRejectKey derives the fast-reject key from the filled-in options'
+// IntegritySecret, or their secret. It's stretched like the integrity key,
+// so that the tag on every cookie is no cheaper an oracle for guessing the
+// secret than the cookie's HMAC. Raw keys are full-entropy, so are only
+// expanded, with HKDF.
+func fastRejectKey(opts Options) []byte {
+	secret := opts.Secret
+	if opts.IntegritySecret != nil {
+		secret = opts.IntegritySecret
+	}
+	if !opts.RawKey {
+		return pbkdf2.Key(secret, []byte(fastRejectInfo), int(opts.Integrity.Iterations), sha256.Size, opts.PBKDF2Hash)
+	}
+
+	key := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte(fastRejectInfo)), key); err != nil {
+		panic("iron-go: cannot derive fast-reject key: " + err.Error())
+	}
+	return key
+}
+
+// fastTag returns the encoded fast-reject tag for the packed cookie.
+func (v *Vault) fastTag(packed string) string {
+	h := hmac.New(sha256.New, v.fastKey)
+	h.Write([]byte(packed))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:fastTagSize])
+}
+
+// checkFastTag verifies and strips the fast-reject tag from the sealed
+// string, returning the packed cookie which follows it. It returns an
+// UnsealError if the tag is missing or wrong.
+func (v *Vault) checkFastTag(sealed string) (string, error) {
+	i := strings.Index(sealed, delimiter)
+	if i < 0 {
+		return "", UnsealError{"Incorrect number of sealed components"}
+	}
+
+	tag, packed := sealed[:i], sealed[i+1:]
+	if !hmac.Equal([]byte(tag), []byte(v.fastTag(packed))) {
+		return "", UnsealError{"Bad hmac value"}
+	}
+
+	return packed, nil
+}
@@ -0,0 +1,84 @@
+package iron
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealsWithFastReject(t *testing.T) {
+	v := New(Options{Secret: password, FastReject: true})
+
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = New(Options{Secret: password}).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Incorrect number of sealed components"}, err)
+}
+
+func TestFastRejectsTamperedCookies(t *testing.T) {
+	v := New(Options{Secret: password, FastReject: true})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	parts := strings.Split(cookie, delimiter)
+	parts[5] = parts[5][1:]
+	_, err = v.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	_, err = v.Unseal(strings.Join(parts[1:], delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	_, err = v.Unseal("garbage")
+	assert.Equal(t, UnsealError{"Incorrect number of sealed components"}, err)
+
+	_, err = New(Options{Secret: rawKey, FastReject: true}).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func benchmarkUnsealGarbage(b *testing.B, opts Options) {
+	v := New(opts)
+	cookie, err := v.Seal(source)
+	if err != nil {
+		b.Fatal(err)
+	}
+	parts := strings.Split(cookie, delimiter)
+	parts[len(parts)-1] = parts[len(parts)-1][1:] + "A"
+	garbage := strings.Join(parts, delimiter)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := v.Unseal(garbage); err == nil {
+			b.Fatal("expected garbage to be rejected")
+		}
+	}
+}
+
+func BenchmarkUnsealGarbage(b *testing.B) {
+	benchmarkUnsealGarbage(b, Options{Secret: password})
+}
+
+func BenchmarkUnsealGarbageFastReject(b *testing.B) {
+	benchmarkUnsealGarbage(b, Options{Secret: password, FastReject: true})
+}
+
+func TestDerivesFastRejectKeyLikeIntegrityKey(t *testing.T) {
+	// The key is stretched with the integrity iterations, and taken from
+	// IntegritySecret when that's set.
+	one := New(Options{Secret: password, FastReject: true})
+	two := New(Options{Secret: password, FastReject: true, Integrity: &Integrity{
+		KeyBits: 256, Iterations: 2, SaltBits: 256, Hash: sha256.New,
+	}})
+	assert.NotEqual(t, one.fastKey, two.fastKey)
+
+	integrity := New(Options{Secret: password, IntegritySecret: rawKey, FastReject: true})
+	assert.Equal(t, New(Options{Secret: rawKey, FastReject: true}).fastKey, integrity.fastKey)
+
+	_, err := NewChecked(Options{Secrets: SecretMap{CurrentID: "a", Secrets: map[string][]byte{"a": password}}, FastReject: true})
+	assert.Equal(t, ConfigError{"FastReject does not support Secrets"}, err)
+}
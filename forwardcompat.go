@@ -0,0 +1,36 @@
+package iron
+
+// ForwardCompatMode selects how Unseal treats cookies with components after
+// the HMAC, as a future format version might append. Extra components are
+// never part of the MAC base, so they're never verified, returned or
+// trusted, whatever the mode.
+type ForwardCompatMode int
+
+const (
+	// ForwardCompatStrict rejects cookies with extra components. It's the
+	// default.
+	ForwardCompatStrict ForwardCompatMode = iota
+	// ForwardCompatWarn accepts cookies with extra components, passing them
+	// to Options.OnForwardCompat once the cookie is verified.
+	ForwardCompatWarn
+	// ForwardCompatAccept silently accepts cookies with extra components.
+	ForwardCompatAccept
+)
+
+// forwardCompatMode returns the effective ForwardCompatMode, treating
+// AllowExtraComponents as ForwardCompatAccept.
+func (o *Options) forwardCompatMode() ForwardCompatMode {
+	if o.ForwardCompatMode == ForwardCompatStrict && o.AllowExtraComponents {
+		return ForwardCompatAccept
+	}
+
+	return o.ForwardCompatMode
+}
+
+// warnForwardCompat passes the message's extra components, if any, to
+// Options.OnForwardCompat in ForwardCompatWarn mode.
+func (v *Vault) warnForwardCompat(msg *message) {
+	if len(msg.extra) > 0 && v.opts.forwardCompatMode() == ForwardCompatWarn && v.opts.OnForwardCompat != nil {
+		v.opts.OnForwardCompat(msg.extra)
+	}
+}
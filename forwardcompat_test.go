@@ -0,0 +1,44 @@
+package iron
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardCompatModes(t *testing.T) {
+	cookie, err := New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+	extended := cookie + delimiter + "future" + delimiter + "more"
+
+	var warnings [][]string
+	onForwardCompat := func(extra []string) { warnings = append(warnings, extra) }
+
+	strict := New(Options{Secret: password, OnForwardCompat: onForwardCompat})
+	_, err = strict.Unseal(extended)
+	assert.Equal(t, UnsealError{"Incorrect number of sealed components"}, err)
+
+	warn := New(Options{Secret: password, ForwardCompatMode: ForwardCompatWarn, OnForwardCompat: onForwardCompat})
+	payload, err := warn.Unseal(extended)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+	_, err = warn.Unseal(cookie)
+	assert.Nil(t, err)
+
+	accept := New(Options{Secret: password, ForwardCompatMode: ForwardCompatAccept, OnForwardCompat: onForwardCompat})
+	payload, err = accept.Unseal(extended)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	assert.Equal(t, [][]string{{"future", "more"}}, warnings)
+
+	// Extra components are never trusted, so a tampered cookie is rejected
+	// without a warning.
+	warnings = nil
+	parts := strings.Split(extended, delimiter)
+	parts[4] = parts[4][1:]
+	_, err = warn.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+	assert.Empty(t, warnings)
+}
@@ -0,0 +1,49 @@
+package iron
+
+import "encoding/binary"
+
+// frameLengthSize is the size of the length before each seal in
+// PackFramed's output.
+const frameLengthSize = 4
+
+// PackFramed concatenates the seals into one blob, each preceded by its
+// length as a big-endian uint32, so they can be stored together and split
+// by UnpackFramed without relying on a delimiter. It works for seals in any
+// encoding, including binary ones.
+func PackFramed(seals []string) []byte {
+	size := 0
+	for _, s := range seals {
+		size += frameLengthSize + len(s)
+	}
+
+	out := make([]byte, 0, size)
+	for _, s := range seals {
+		var n [frameLengthSize]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(s)))
+		out = append(out, n[:]...)
+		out = append(out, s...)
+	}
+
+	return out
+}
+
+// UnpackFramed splits a blob made by PackFramed back into its seals. It
+// returns an UnsealError if the blob is truncated. The seals themselves
+// aren't verified.
+func UnpackFramed(b []byte) ([]string, error) {
+	var seals []string
+	for len(b) > 0 {
+		if len(b) < frameLengthSize {
+			return nil, UnsealError{"Truncated framed seals"}
+		}
+		n := binary.BigEndian.Uint32(b)
+		b = b[frameLengthSize:]
+		if uint64(n) > uint64(len(b)) {
+			return nil, UnsealError{"Truncated framed seals"}
+		}
+		seals = append(seals, string(b[:n]))
+		b = b[n:]
+	}
+
+	return seals, nil
+}
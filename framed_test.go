@@ -0,0 +1,35 @@
+package iron
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacksFramedSeals(t *testing.T) {
+	v := New(Options{Secret: password})
+	small, err := v.Seal(source)
+	assert.Nil(t, err)
+	large, err := v.Seal([]byte(strings.Repeat("x", 1<<20)))
+	assert.Nil(t, err)
+	binary := string([]byte{0, 1, 2, '*', 0xff})
+
+	seals := []string{small, "", large, binary, small}
+	blob := PackFramed(seals)
+	out, err := UnpackFramed(blob)
+	assert.Nil(t, err)
+	assert.Equal(t, seals, out)
+	payload, err := v.Unseal(out[2])
+	assert.Nil(t, err)
+	assert.Len(t, payload, 1<<20)
+
+	out, err = UnpackFramed(PackFramed(nil))
+	assert.Nil(t, err)
+	assert.Empty(t, out)
+
+	for _, n := range []int{1, 3, len(blob) - 1} {
+		_, err = UnpackFramed(blob[:n])
+		assert.Equal(t, UnsealError{"Truncated framed seals"}, err)
+	}
+}
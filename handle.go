@@ -0,0 +1,56 @@
+package iron
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// SealWithHandle seals the payload like Seal, and also returns a handle for
+// the cookie: an opaque identifier, unique to this seal, under which
+// server-side state for it can be stored. The handle is an HMAC of the
+// cookie under a key derived from the integrity secret like an integrity
+// key, so it reveals nothing about the payload, no more about the secret
+// than the cookie's own HMAC, and can't be computed from the cookie without
+// the secret. Handle recomputes it from the cookie.
+func (v *Vault) SealWithHandle(b []byte) (cookie string, handle string, err error) {
+	cookie, info, err := v.SealWithInfo(b)
+	if err != nil {
+		return "", "", err
+	}
+
+	sealer := v
+	if v.opts.Secrets != nil {
+		if sealer, err = v.lookupSecret(info.PasswordID); err != nil {
+			return "", "", err
+		}
+	}
+	if handle, err = sealer.handle(cookie); err != nil {
+		return "", "", err
+	}
+
+	return cookie, handle, nil
+}
+
+// Handle verifies the cookie like Verify, and returns the handle which
+// SealWithHandle returned for it.
+func (v *Vault) Handle(sealed string) (string, error) {
+	_, v, err := v.verify(sealed, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return v.handle(sealed)
+}
+
+// handle returns the handle for the sealed cookie under the vault's secret.
+func (v *Vault) handle(sealed string) (string, error) {
+	key, err := v.labelKey("iron-go handle")
+	if err != nil {
+		return "", err
+	}
+
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(sealed))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
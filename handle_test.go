@@ -0,0 +1,57 @@
+package iron
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealsWithHandle(t *testing.T) {
+	v := New(Options{Secret: password})
+	cookie, handle, err := v.SealWithHandle(source)
+	assert.Nil(t, err)
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	again, err := v.Handle(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, handle, again)
+
+	other, otherHandle, err := v.SealWithHandle(source)
+	assert.Nil(t, err)
+	assert.NotEqual(t, cookie, other)
+	assert.NotEqual(t, handle, otherHandle)
+
+	assert.NotContains(t, handle, string(source))
+	assert.NotContains(t, handle, string(password))
+	_, err = New(Options{Secret: rawKey}).Handle(cookie)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	// Handles follow the secret a cookie was sealed with.
+	secrets := newRotatingSecrets()
+	rotating := New(Options{Secrets: secrets})
+	cookie, handle, err = rotating.SealWithHandle(source)
+	assert.Nil(t, err)
+	secrets.rotate("two")
+	again, err = rotating.Handle(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, handle, again)
+}
+
+func TestKeysHandleFromIntegritySecret(t *testing.T) {
+	v := New(Options{Secret: password, IntegritySecret: rawKey})
+	cookie, handle, err := v.SealWithHandle(source)
+	assert.Nil(t, err)
+
+	other, err := New(Options{Secret: password, IntegritySecret: password}).handle(cookie)
+	assert.Nil(t, err)
+	assert.NotEqual(t, handle, other)
+
+	raw := New(Options{Secret: rawKey, RawKey: true})
+	cookie, handle, err = raw.SealWithHandle(source)
+	assert.Nil(t, err)
+	stretched, err := New(Options{Secret: rawKey}).handle(cookie)
+	assert.Nil(t, err)
+	assert.NotEqual(t, handle, stretched)
+}
@@ -0,0 +1,54 @@
+package iron
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"reflect"
+	"sort"
+)
+
+// hashes is the registry of hashes available via HashByName.
+var hashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// HashByName returns the hash registered under the name, such as "sha256".
+// It returns an error if the name is unknown.
+func HashByName(name string) (func() hash.Hash, error) {
+	h, ok := hashes[name]
+	if !ok {
+		return nil, fmt.Errorf("iron-go: unknown hash %q", name)
+	}
+
+	return h, nil
+}
+
+// SupportedHashes returns the sorted names accepted by HashByName.
+func SupportedHashes() []string {
+	names := make([]string, 0, len(hashes))
+	for name := range hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hashName returns the name the hash is registered under, or "" if it isn't
+// registered.
+func hashName(h func() hash.Hash) string {
+	if h == nil {
+		return ""
+	}
+	for name, registered := range hashes {
+		if reflect.ValueOf(registered).Pointer() == reflect.ValueOf(h).Pointer() {
+			return name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,123 @@
+package iron
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CookieDefaults controls the attributes of cookies created by Cookie and
+// SealCookie. Its zero value produces cookies which are Secure, HttpOnly and
+// SameSite=Lax, as session cookies should be; weakening them requires
+// opting out explicitly.
+type CookieDefaults struct {
+	// Path is the cookie's path. Defaults to "/".
+	Path string
+	// Domain is the cookie's domain. Defaults to the request's host.
+	Domain string
+	// SameSite is the cookie's SameSite mode. Defaults to Lax.
+	SameSite http.SameSite
+	// Insecure omits the Secure attribute, allowing the cookie to be sent
+	// over plain HTTP.
+	Insecure bool
+	// ScriptAccessible omits the HttpOnly attribute, allowing the cookie to
+	// be read by scripts.
+	ScriptAccessible bool
+}
+
+// Cookie seals the payload into a cookie with the name, whose attributes are
+// set by Options.CookieDefaults. If the vault has a TTL, the cookie expires
+// along with the seal.
+func (v *Vault) Cookie(name string, b []byte) (*http.Cookie, error) {
+	sealed, err := v.Seal(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.cookie(name, sealed), nil
+}
+
+// cookie returns a cookie with the name and sealed value, whose attributes
+// are set by Options.CookieDefaults.
+func (v *Vault) cookie(name, sealed string) *http.Cookie {
+	d := v.opts.CookieDefaults
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    sealed,
+		Path:     d.Path,
+		Domain:   d.Domain,
+		SameSite: d.SameSite,
+		Secure:   !d.Insecure,
+		HttpOnly: !d.ScriptAccessible,
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	if cookie.SameSite == 0 {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+	if v.opts.TTL > 0 {
+		cookie.MaxAge = int(v.opts.TTL / time.Second)
+	}
+
+	return cookie
+}
+
+// SealCookie seals the payload into a cookie like Cookie, and sets it on the
+// response.
+func (v *Vault) SealCookie(w http.ResponseWriter, name string, b []byte) error {
+	cookie, err := v.Cookie(name, b)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+// CookieError pairs a cookie's name with the error unsealing it.
+type CookieError struct {
+	Name string
+	Err  error
+}
+
+// CookieErrors is returned from UnsealFirst when none of the named cookies
+// could be unsealed. It lists the error for each cookie that was present.
+type CookieErrors []CookieError
+
+// Error implements error.Error
+func (c CookieErrors) Error() string {
+	msgs := make([]string, len(c))
+	for i, err := range c {
+		msgs[i] = err.Name + ": " + err.Err.Error()
+	}
+
+	return "iron-go: no cookie could be unsealed: " + strings.Join(msgs, "; ")
+}
+
+// UnsealFirst tries to unseal each of the named cookies on the request, in
+// order, and returns the payload and name of the first one which unseals.
+// Missing cookies are skipped. If none of the cookies are present it returns
+// http.ErrNoCookie, and if none of the present cookies unseal it returns
+// CookieErrors.
+func (v *Vault) UnsealFirst(r *http.Request, names ...string) ([]byte, string, error) {
+	var errs CookieErrors
+	for _, name := range names {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			continue
+		}
+
+		payload, err := v.Unseal(cookie.Value)
+		if err == nil {
+			return payload, name, nil
+		}
+		errs = append(errs, CookieError{name, err})
+	}
+
+	if len(errs) == 0 {
+		return nil, "", http.ErrNoCookie
+	}
+
+	return nil, "", errs
+}
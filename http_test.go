@@ -0,0 +1,82 @@
+package iron
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnsealsFirstValidCookie(t *testing.T) {
+	v := New(Options{Secret: password})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "old", Value: "garbage"})
+	r.AddCookie(&http.Cookie{Name: "new", Value: cookie})
+
+	payload, name, err := v.UnsealFirst(r, "missing", "old", "new")
+	assert.Nil(t, err)
+	assert.Equal(t, "new", name)
+	assert.Equal(t, source, payload)
+}
+
+func TestUnsealFirstReportsEachFailure(t *testing.T) {
+	v := New(Options{Secret: password})
+	cookie, err := New(Options{Secret: rawKey}).Seal(source)
+	assert.Nil(t, err)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "old", Value: "garbage"})
+	r.AddCookie(&http.Cookie{Name: "new", Value: cookie})
+
+	_, _, err = v.UnsealFirst(r, "missing", "old", "new")
+	assert.Equal(t, CookieErrors{
+		{"old", UnsealError{"Incorrect number of sealed components"}},
+		{"new", UnsealError{"Bad hmac value"}},
+	}, err)
+	assert.EqualError(t, err, "iron-go: no cookie could be unsealed: old: Incorrect number of sealed components; new: Bad hmac value")
+
+	_, _, err = v.UnsealFirst(r, "missing")
+	assert.Equal(t, http.ErrNoCookie, err)
+}
+
+func TestSealsCookieWithSafeDefaults(t *testing.T) {
+	v := New(Options{Secret: password, TTL: time.Hour})
+	w := httptest.NewRecorder()
+	assert.Nil(t, v.SealCookie(w, "session", source))
+
+	header := w.Header().Get("Set-Cookie")
+	assert.Contains(t, header, "; Path=/")
+	assert.Contains(t, header, "; Max-Age=3600")
+	assert.Contains(t, header, "; HttpOnly")
+	assert.Contains(t, header, "; Secure")
+	assert.Contains(t, header, "; SameSite=Lax")
+
+	r := &http.Request{Header: http.Header{"Cookie": {header}}}
+	payload, name, err := v.UnsealFirst(r, "session")
+	assert.Nil(t, err)
+	assert.Equal(t, "session", name)
+	assert.Equal(t, source, payload)
+}
+
+func TestSealsCookieWithOptedOutDefaults(t *testing.T) {
+	v := New(Options{Secret: password, CookieDefaults: CookieDefaults{
+		Path:             "/app",
+		SameSite:         http.SameSiteStrictMode,
+		Insecure:         true,
+		ScriptAccessible: true,
+	}})
+	w := httptest.NewRecorder()
+	assert.Nil(t, v.SealCookie(w, "session", source))
+
+	header := w.Header().Get("Set-Cookie")
+	assert.Contains(t, header, "; Path=/app")
+	assert.Contains(t, header, "; SameSite=Strict")
+	assert.NotContains(t, header, "HttpOnly")
+	assert.NotContains(t, header, "Secure")
+	assert.NotContains(t, header, "Max-Age")
+}
@@ -4,22 +4,41 @@ import (
 	"bytes"
 	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"hash"
+	"io"
 	"time"
+	"unicode/utf8"
 
+	"golang.org/x/crypto/hkdf"
 	"golang.org/x/crypto/pbkdf2"
 )
 
-// Padding symbol used by Iron. This will be added when encrypting and trimmed
-// out when decrypting.
+// Padding symbol used by earlier versions of iron-go, when
+// Encryption.LegacyTabPadding is set. This will be added when encrypting and
+// trimmed out when decrypting.
 const padder = '\t'
 
+// ErrRawKeyLength is returned when Options.RawKey is set and the secret
+// isn't exactly rawKeySize bytes, or when a key given to SealWithKey or
+// UnsealWithKey doesn't match KeyBits.
+var ErrRawKeyLength = errors.New("iron-go: raw key is the wrong length")
+
+// rawKeySize is the length of the secret, and of any IntegritySecret, when
+// Options.RawKey is set: a full 256-bit key for HKDF-SHA256 to split.
+const rawKeySize = 32
+
 // An Integrity struct is contained in the Options struct and describes
-// configuration for cookie integrity verification.
+// configuration for cookie integrity verification. The integrity key is
+// derived separately from the encryption key, from its own salt, so its
+// parameters may differ from the Encryption ones.
 type Integrity struct {
 	// KeyBits defines how large the signing key should be.
 	KeyBits uint
@@ -58,9 +77,61 @@ type Encryption struct {
 	// IVBits is the number of IV bits to generate, ignored if the the IV
 	// property is set explicitly.
 	IVBits uint
+
+	// LegacyTabPadding pads plaintext with tabs, which are trimmed after
+	// decryption, rather than with PKCS#7 as Node Iron does. Earlier
+	// versions of iron-go padded this way, so it's needed to read cookies
+	// they sealed, but it isn't interoperable with Node and corrupts
+	// payloads which end in tabs.
+	LegacyTabPadding bool
+
+	// PadToMultiple, if positive, pads the plaintext with its length and
+	// zeroes up to a multiple of this many bytes before encryption, so that
+	// payloads of similar sizes seal to the same length. Padded cookies
+	// record this in an authenticated extension, so any vault can unseal
+	// them.
+	PadToMultiple int
+
+	// DerivedKeyBytes, if positive, is the length of key derived from the
+	// secret in place of KeyBits/8, to match implementations which derive a
+	// longer key and truncate it, or a shorter one and stretch it. The
+	// Cipher is passed the whole derived key, and is responsible for using
+	// the right part of it. Longer derivations begin with the shorter ones.
+	// The built-in AES ciphers use the first bytes of a longer key, while
+	// stretching a shorter one needs a custom Cipher.
+	DerivedKeyBytes int
 }
 
+// derivedKeyBits returns the length of the encryption key derived from the
+// secret, in bits.
+func (e *Encryption) derivedKeyBits() uint {
+	if e.DerivedKeyBytes > 0 {
+		return uint(e.DerivedKeyBytes) * 8
+	}
+
+	return e.KeyBits
+}
+
+// MACOrder selects the order of encryption and authentication.
+type MACOrder int
+
+const (
+	// EncryptThenMAC computes the HMAC over the encrypted cookie, so that
+	// forged cookies are rejected before decryption. It's the default.
+	EncryptThenMAC MACOrder = iota
+	// MACThenEncrypt computes the HMAC over the cleartext components and
+	// the plaintext, and encrypts it with the plaintext, for legacy peers
+	// which require it. The cookie's HMAC component is left empty.
+	MACThenEncrypt
+)
+
 // Options is passed into New() to configure the cookie options.
+//
+// Some options, such as EmbedIssuedAt, IncludeKCV, EmbedTTL,
+// EmbedParameters, Transformers, Issuer and Audience, record themselves in
+// authenticated extension components between the expiration and the HMAC
+// salt. Node Iron expects a fixed number of components, so it can't read
+// cookies sealed with any of them.
 type Options struct {
 	// Secret key to use for encrypting/decrypting data.
 	Secret []byte
@@ -70,6 +141,209 @@ type Options struct {
 	TimestampSkew time.Duration
 	// Local clock offset, defaults to zero.
 	LocalTimeOffset time.Duration
+	// OmitPrefix drops the constant "Fe26.2" prefix from sealed output and
+	// expects it to be absent when unsealing. The prefix is still included
+	// in the HMAC base, so authentication is unchanged.
+	OmitPrefix bool
+	// EmbedIssuedAt adds the time of sealing as an extra component which can
+	// be read without the secret via ParseSeal. The component is covered by
+	// the HMAC, but anyone reading it without verifying the seal must treat
+	// it as advisory.
+	EmbedIssuedAt bool
+	// IncludeKCV adds a key check value to sealed cookies: a few bytes of
+	// HMAC, under the cookie's integrity key, of a fixed string. Unseal
+	// checks it before the full HMAC, and returns "Wrong secret" rather than
+	// "Bad hmac value" if it doesn't match, to tell a misconfigured secret
+	// from tampering. The KCV is covered by the HMAC, but a tampered KCV
+	// also gives "Wrong secret".
+	IncludeKCV bool
+	// EmbedTTL adds the TTL as an extra component, so that the window a
+	// cookie was sealed with is known when it's unsealed, and Reseal can
+	// refresh the same window.
+	EmbedTTL bool
+	// EmbedParameters adds the cipher, hash and key derivation parameters as
+	// an extra component. Since it's covered by the HMAC, the parameters
+	// can't be downgraded without detection, and a vault only unseals
+	// cookies whose parameters match its own. They also allow VaultFromSeal
+	// to configure a vault for the cookie.
+	EmbedParameters bool
+	// HMACEncoding selects how the HMAC component is encoded. Defaults to
+	// Base64URL; cookies with any other encoding can't be read by Node Iron.
+	HMACEncoding HMACEncoding
+	// Normalizer, if set, rewrites payloads before they're sealed, so that
+	// logically identical payloads seal identically under fixed salts and
+	// IVs. CanonicalJSON is a normalizer for JSON payloads. Unsealing
+	// returns the normalized payload. It's applied by Seal and its
+	// variants which take a single payload, but not to the content keys
+	// sealed by SealMulti, SealEnvelope, SealStream or WrapConn, nor the
+	// payloads they encrypt with them.
+	Normalizer func([]byte) ([]byte, error)
+	// Transformers is a chain of transformations applied to payloads in
+	// order before they're encrypted, and in reverse after they're
+	// decrypted. The chain is recorded in the cookie, and a vault only
+	// unseals cookies transformed by the same chain, or not at all.
+	Transformers []Transformer
+	// Compression selects whether payloads are compressed before they're
+	// encrypted. Defaults to CompressionNone.
+	Compression Compression
+	// AllowExtraComponents makes Unseal accept cookies with components after
+	// the HMAC, as a future format version might append. The extra
+	// components are ignored entirely: they're not part of the MAC base and
+	// are never verified or returned. It's equivalent to ForwardCompatMode
+	// ForwardCompatAccept.
+	AllowExtraComponents bool
+	// ForwardCompatMode selects whether Unseal rejects, warns about or
+	// accepts cookies with components after the HMAC. Defaults to
+	// ForwardCompatStrict.
+	ForwardCompatMode ForwardCompatMode
+	// OnForwardCompat, if set, is called in ForwardCompatWarn mode with the
+	// extra components of each verified cookie which has them.
+	OnForwardCompat func(extra []string)
+	// Base64Alphabet, if set, replaces the base64url alphabet of the salt,
+	// IV, body and HMAC components, and of base64 extensions such as the
+	// issuer, with these 64 characters, for transports which can't carry
+	// "-" or "_". It may not contain "*" or "=". Cookies sealed with it can
+	// only be read by vaults with the same alphabet, which reject any
+	// component with characters outside it.
+	Base64Alphabet string
+	// StreamRekeyFrames and StreamRekeyBytes, if positive, make SealStream
+	// ratchet to a new stream key after that many frames or bytes of
+	// plaintext under the current key, whichever comes first.
+	StreamRekeyFrames int
+	StreamRekeyBytes  int64
+	// OnProgress, if set, is called by SealStream and UnsealStream after
+	// each frame with the bytes of plaintext processed so far, and the
+	// total, or -1 if it's unknown. SealStream knows the total when the
+	// source has a Len method, as *bytes.Reader does; UnsealStream never
+	// does.
+	OnProgress func(bytesProcessed, total int64)
+	// ConnSequenceNumbers makes WrapConn send each frame's sequence number
+	// with it, so that a frame out of order or replayed is rejected with
+	// "Frame sequence error" rather than "Bad hmac value". Both peers must
+	// agree on it.
+	ConnSequenceNumbers bool
+	// ExpirationResolution selects whether the expiration component is in
+	// milliseconds, the default and Node Iron's format, or seconds, as some
+	// other implementations expect. Cookies in the wrong resolution are
+	// rejected: milliseconds read as seconds are out of range, and seconds
+	// read as milliseconds have long expired.
+	ExpirationResolution TimestampResolution
+	// MACOrder selects whether the HMAC covers the ciphertext, the default,
+	// or the plaintext. MACThenEncrypt exists only to interoperate with
+	// legacy peers, and is weaker: cookies must be decrypted before they're
+	// authenticated, exposing the cipher and its padding to forged input,
+	// as in padding oracle attacks, and leaving the salt, IV and body
+	// authenticated only through decryption. Don't use it unless a peer
+	// requires it.
+	MACOrder MACOrder
+	// MACFormatVersion is the version in the MAC prefix of sealed cookies,
+	// as in "Fe26.2". Defaults to "2". All versions so far share the same
+	// layout, so only the prefix changes.
+	MACFormatVersion string
+	// AcceptedMACVersions lists the MAC format versions accepted when
+	// unsealing, for migrating between versions. Defaults to just the
+	// MACFormatVersion.
+	AcceptedMACVersions []string
+	// RenewalGrace lets Reseal renew cookies which expired up to this long
+	// ago, beyond TimestampSkew. Unseal still rejects them.
+	RenewalGrace time.Duration
+	// RenewalMaxAge, if positive, stops Reseal renewing expired cookies
+	// which were issued longer ago than this, according to their embedded
+	// issued-at time. Expired cookies without one aren't renewed. Reseal
+	// preserves the issued-at time, so renewal can't extend a cookie's
+	// life beyond it.
+	RenewalMaxAge time.Duration
+	// EncryptExpiration moves the expiration from its cleartext component
+	// into the encrypted payload, so that the cookie doesn't reveal its
+	// lifetime. The expiration is then checked only after decryption, and
+	// not by Verify. The cookie records that its expiration is encrypted,
+	// in an extension, so any vault can unseal it.
+	EncryptExpiration bool
+	// Issuer, if set, identifies the sealer in an extra component, which is
+	// authenticated but readable without the secret via ParseSeal.
+	Issuer string
+	// AcceptedIssuers, if set, lists the only issuers whose cookies are
+	// unsealed. Others, including cookies without an issuer, are rejected.
+	AcceptedIssuers []string
+	// Audience, if set, identifies who the cookie is for, such as a region,
+	// in an extra component, which is authenticated but readable without
+	// the secret via ParseSeal.
+	Audience string
+	// AcceptedAudiences, if set, lists the only audiences whose cookies are
+	// unsealed. Others, including cookies without an audience, are rejected.
+	AcceptedAudiences []string
+	// StrictSaltLength rejects cookies whose salts aren't the length this
+	// library would generate for the configured SaltBits, catching cookies
+	// from foreign or misconfigured sealers early. Node Iron encodes its
+	// salts differently, so its cookies are rejected, as are cookies sealed
+	// by a SessionVault with salts of other lengths.
+	StrictSaltLength bool
+	// VerboseErrors makes Unseal report which component of a malformed
+	// cookie failed to decode, and why, instead of a terse message.
+	VerboseErrors bool
+	// RawKey derives the encryption and integrity keys from the secret
+	// with HKDF-SHA256, each under its own info string, skipping PBKDF2
+	// and ignoring the salts. It's only appropriate for full-entropy keys,
+	// such as those from a KMS, so the secret must be exactly 32 bytes,
+	// lest a passphrase lose its stretching by mistake. The keys derived
+	// may be any length that KeyBits allows, such as 128-bit AES keys.
+	RawKey bool
+	// FastReject prepends a short tag, keyed with a secondary key derived
+	// once at construction, which Unseal checks before the per-cookie
+	// PBKDF2 derivation. This makes rejecting garbage cookies cheap. The
+	// key is derived from IntegritySecret if set, or Secret otherwise, with
+	// the integrity key's PBKDF2 parameters, so the tag is as costly to
+	// guess the secret from as the cookie's own HMAC; raising
+	// Integrity.Iterations raises both. Cookies sealed with it can't be
+	// read by Node Iron, nor by vaults without the option. It isn't
+	// supported with Secrets, since a single key can't follow rotation.
+	FastReject bool
+	// PBKDF2Hash is the PRF used to derive keys from the secret. Defaults to
+	// SHA-1, which is what Node Iron uses; changing it breaks interop with
+	// Node and with cookies sealed under a different PRF.
+	PBKDF2Hash func() hash.Hash
+	// MaxPlaintextSize is the longest payload Seal accepts, failing with
+	// ErrPayloadTooLarge for longer ones. Unseal fails likewise rather than
+	// inflate a compressed payload beyond it. Unlimited if zero, the
+	// default, or negative. SealedSize tells how large a payload fits in
+	// the 4096 bytes browsers reliably store.
+	MaxPlaintextSize int
+	// IVReuseDetector, if set, checks each freshly generated IV against
+	// those generated recently, and fails the seal with ErrIVReuse if it
+	// has been seen before.
+	IVReuseDetector *IVReuseDetector
+	// IntegritySecret, if set, is used in place of Secret to derive the
+	// integrity key, so that it can be shared with services which only
+	// verify cookies while Secret stays private. A vault with only an
+	// IntegritySecret can Verify cookies, but not seal or unseal them. It's
+	// not supported with Secrets.
+	IntegritySecret []byte
+	// Secrets, if set, supplies the secrets used for sealing and
+	// unsealing in place of Secret, allowing them to be rotated. The ID of
+	// the secret used to seal a cookie is embedded in it, as in Node Iron.
+	Secrets SecretProvider
+	// RevokedPasswordIDs rejects cookies sealed with the secrets having
+	// these IDs, even while the secrets remain available, so that cookies
+	// under a compromised secret can be invalidated at once.
+	RevokedPasswordIDs map[string]bool
+	// CookieDefaults sets the attributes of cookies created by Cookie and
+	// SealCookie. Its zero value is safe for session cookies.
+	CookieDefaults CookieDefaults
+	// Rand is the source of randomness for salts and IVs. Defaults to
+	// crypto/rand.Reader, and should only be replaced in tests.
+	Rand io.Reader
+	// RandFallbacks are tried in order whenever Rand fails. If they all
+	// fail too, sealing returns a RandomError.
+	RandFallbacks []io.Reader
+	// SealRetries is the number of times reading from the random sources is
+	// retried, after a short and growing delay, before sealing fails. It
+	// may not be negative. Other failures aren't retried.
+	SealRetries int
+	// SaltSource, if set, generates salts in place of Rand, for example
+	// from an HSM or an auditable counter. It must return exactly the
+	// requested number of bytes, and should never return the same salt
+	// twice: repeated salts produce repeated keys.
+	SaltSource func(bits uint) ([]byte, error)
 
 	Encryption *Encryption
 	Integrity  *Integrity
@@ -77,14 +351,36 @@ type Options struct {
 
 // fillDefaults creates a new Options object with default values filled in.
 func (o Options) fillDefaults() Options {
-	if len(o.Secret) < 32 {
+	if len(o.Secret) < 32 && o.Secrets == nil && !o.verifyOnly() {
 		panic("iron-go: secret key may not be less than 32 bits")
 	}
+	if o.IntegritySecret != nil && o.Secrets != nil {
+		panic("iron-go: IntegritySecret is not supported with Secrets")
+	}
+	if o.FastReject && o.Secrets != nil {
+		panic("iron-go: FastReject does not support Secrets")
+	}
+	if o.IntegritySecret != nil && len(o.IntegritySecret) < 32 {
+		panic("iron-go: integrity secret may not be less than 32 bytes")
+	}
+	if o.Base64Alphabet != "" {
+		if problem := checkBase64Alphabet(o.Base64Alphabet); problem != "" {
+			panic("iron-go: " + problem)
+		}
+	}
 
 	if o.TimestampSkew == 0 {
 		o.TimestampSkew = time.Second * 60
 	}
 
+	if o.PBKDF2Hash == nil {
+		o.PBKDF2Hash = sha1.New
+	}
+
+	if o.Rand == nil {
+		o.Rand = rand.Reader
+	}
+
 	if o.Encryption == nil {
 		o.Encryption = &Encryption{
 			IVBits:     16,
@@ -108,13 +404,124 @@ func (o Options) fillDefaults() Options {
 }
 
 // New creates a new Vault which can seal and unseal Iron cookies.
-func New(options Options) *Vault { return &Vault{options.fillDefaults()} }
+func New(options Options) *Vault { return newVault(options.fillDefaults()) }
+
+// NewDeterministic creates a new Vault which draws all of its salts and IVs
+// from the provided reader, so that the same reader contents always produce
+// the same seals. It exists for testing only: predictable salts and IVs void
+// the security of Iron, and it must never be used in production.
+func NewDeterministic(secret []byte, r io.Reader) *Vault {
+	return New(Options{Secret: secret, Rand: r})
+}
 
 // Vault is a structure capable is sealing and unsealing Iron cookies.
-type Vault struct{ opts Options }
+type Vault struct {
+	opts Options
+
+	// fastKey keys the fast-reject tag, if Options.FastReject is set.
+	fastKey []byte
+	// session holds the fixed salts and cached keys of a SessionVault.
+	session *session
+	// keys deduplicates concurrent key derivations. It's shared by the
+	// copies made for other secrets, since the secret is part of its key.
+	keys *keyFlight
+	// suppliedKeys uses the secret verbatim as the key, for SealWithKey.
+	suppliedKeys bool
+	// expiryGrace extends TimestampSkew for expirations alone, for
+	// Reseal's RenewalGrace.
+	expiryGrace time.Duration
+	// zero is shared with copies of the vault, like keys, and records
+	// whether Zeroize has wiped the secret.
+	zero *zeroizer
+}
+
+// newVault creates a vault from filled-in options, deriving any keys it
+// caches up front.
+func newVault(opts Options) *Vault {
+	v := &Vault{opts: opts, keys: &keyFlight{}, zero: &zeroizer{}}
+	if opts.FastReject {
+		v.fastKey = fastRejectKey(opts)
+	}
+
+	return v
+}
+
+// ForSubject returns a vault whose secret is derived from this vault's secret
+// and the subject ID using HKDF-SHA256, so that each subject's cookies are
+// sealed under a distinct key. Cookies sealed for one subject can't be
+// unsealed by a vault for another subject, nor by the parent vault. If the
+// vault uses a SecretProvider, each of its secrets is derived in turn, and
+// any IntegritySecret is derived for the subject too. Subject vaults share
+// the parent's Zeroize: zeroizing either makes both unusable.
+func (v *Vault) ForSubject(subjectID []byte) *Vault {
+	if v.checkZeroized() != nil {
+		c := *v
+		return &c
+	}
+
+	opts := v.opts
+	if opts.Secrets != nil {
+		opts.Secrets = subjectSecrets{opts.Secrets, subjectID}
+	} else {
+		opts.Secret = deriveSubjectSecret(opts.Secret, subjectID)
+	}
+	if opts.IntegritySecret != nil {
+		opts.IntegritySecret = deriveSubjectSecret(opts.IntegritySecret, subjectID)
+	}
+
+	c := newVault(opts)
+	c.zero = v.zero
+	v.zero.track(opts.Secret, opts.IntegritySecret, c.fastKey)
+	return c
+}
+
+// keyRole distinguishes the encryption and integrity keys, and those for
+// labels such as a Code's, which are derived from a raw key with distinct
+// HKDF info strings.
+type keyRole string
+
+const (
+	encryptionKey keyRole = "iron-go raw encryption key"
+	integrityKey  keyRole = "iron-go raw integrity key"
+)
+
+func (v *Vault) generateKey(role keyRole, keybits uint, iterations uint, salt []byte) ([]byte, error) {
+	if err := v.checkZeroized(); err != nil {
+		return nil, err
+	}
+	if v.suppliedKeys {
+		if uint(len(v.opts.Secret))*8 != keybits {
+			return nil, ErrRawKeyLength
+		}
+		return v.opts.Secret, nil
+	}
+	if v.opts.RawKey {
+		if len(v.opts.Secret) != rawKeySize {
+			return nil, ErrRawKeyLength
+		}
+		key := make([]byte, keybits/8)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, v.opts.Secret, nil, []byte(role)), key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if key := v.session.key(v.opts.Secret, keybits, iterations, salt); key != nil {
+		return key, nil
+	}
+
+	return v.deriveBytes(int(keybits/8), iterations, salt), nil
+}
 
-func (v *Vault) generateKey(keybits uint, iterations uint, salt []byte) []byte {
-	return pbkdf2.Key(v.opts.Secret, salt, int(iterations), int(keybits/8), sha1.New)
+// deriveBytes derives n bytes of key material from the secret and salt. The
+// output for a shorter n is always a prefix of the output for a longer one,
+// so a key and any further material (such as a nonce) can be taken from a
+// single derivation. Concurrent identical derivations share one
+// computation, so callers must not modify the result.
+func (v *Vault) deriveBytes(n int, iterations uint, salt []byte) []byte {
+	id := keyFlightID(v.opts.Secret, salt, n, iterations)
+	return v.keys.do(id, func() []byte {
+		return pbkdf2.Key(v.opts.Secret, salt, int(iterations), n, v.opts.PBKDF2Hash)
+	})
 }
 
 type hmacResult struct {
@@ -123,8 +530,10 @@ type hmacResult struct {
 }
 
 func (v *Vault) hmacWithPassword(salt []byte, data string) (digest []byte, err error) {
-	key := v.generateKey(v.opts.Integrity.KeyBits, v.opts.Integrity.Iterations, salt)
-	h := hmac.New(v.opts.Integrity.Hash, key)
+	h, err := v.integrityHasher(salt)
+	if err != nil {
+		return nil, err
+	}
 	if _, err := h.Write([]byte(data)); err != nil {
 		return nil, err
 	}
@@ -132,20 +541,109 @@ func (v *Vault) hmacWithPassword(salt []byte, data string) (digest []byte, err e
 	return h.Sum(nil), nil
 }
 
+// IntegrityHasher returns an HMAC keyed with the integrity key the vault
+// derives for the salt, for reusing the vault's integrity primitive without
+// exposing the key. It's keyed from IntegritySecret if that's set, or the
+// secret otherwise, which for a vault with Secrets is the current one.
+func (v *Vault) IntegrityHasher(salt []byte) (hash.Hash, error) {
+	if v.opts.Secrets != nil {
+		var err error
+		if _, v, err = v.currentSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	return v.integrityHasher(salt)
+}
+
+// integrityHasher is IntegrityHasher for a vault whose secret has been
+// resolved.
+func (v *Vault) integrityHasher(salt []byte) (hash.Hash, error) {
+	if v.opts.IntegritySecret != nil {
+		c := *v
+		c.opts.Secret = v.opts.IntegritySecret
+		v = &c
+	}
+	key, err := v.generateKey(integrityKey, v.opts.Integrity.KeyBits, v.opts.Integrity.Iterations, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return hmac.New(v.opts.Integrity.Hash, key), nil
+}
+
+// keyCheckValue returns the key check value for the integrity hasher: the
+// first bytes of its HMAC of a fixed string. It resets the hasher before
+// and after.
+func keyCheckValue(h hash.Hash) []byte {
+	h.Reset()
+	io.WriteString(h, kcvInput)
+	kcv := h.Sum(nil)[:kcvSize]
+	h.Reset()
+	return kcv
+}
+
 func (v *Vault) decrypt(msg *message) ([]byte, error) {
-	key := v.generateKey(v.opts.Encryption.KeyBits, v.opts.Encryption.Iterations, msg.Salt)
+	return v.decryptAppend(nil, msg)
+}
+
+// decryptAppend decrypts the message's body, appending the plaintext to
+// dst, which is grown only if its capacity is too small.
+func (v *Vault) decryptAppend(dst []byte, msg *message) ([]byte, error) {
+	if v.opts.verifyOnly() {
+		return nil, ErrVerifyOnly
+	}
+	// Block modes panic on misaligned input, which is unauthenticated in
+	// MAC-then-encrypt mode. Even when authenticated, a cookie from a
+	// cipher with another block size must not be decrypted, as unpadding
+	// could yield the wrong plaintext. IVBits must be the cipher's block
+	// size, as NewChecked ensures.
+	if len(msg.IV) != int(v.opts.Encryption.IVBits) {
+		return nil, UnsealError{"IV length does not match cipher block size"}
+	}
+	key, err := v.generateKey(encryptionKey, v.opts.Encryption.derivedKeyBits(), v.opts.Encryption.Iterations, msg.Salt)
+	if err != nil {
+		return nil, err
+	}
 	_, decrypt, err := v.opts.Encryption.Cipher(key, msg.IV)
 	if err != nil {
 		return nil, err
 	}
+	if len(msg.EncryptedBody)%decrypt.BlockSize() != 0 {
+		return nil, UnsealError{"Ciphertext length is not a multiple of cipher block size"}
+	}
 
-	data := make([]byte, len(msg.EncryptedBody))
+	n := len(dst)
+	if cap(dst)-n < len(msg.EncryptedBody) {
+		grown := make([]byte, n, n+len(msg.EncryptedBody))
+		copy(grown, dst)
+		dst = grown
+	}
+	data := dst[n : n+len(msg.EncryptedBody)]
 	decrypt.CryptBlocks(data, msg.EncryptedBody)
-	return bytes.TrimRight(data, string(padder)), nil
+	if v.opts.Encryption.LegacyTabPadding {
+		return dst[:n+len(bytes.TrimRight(data, string(padder)))], nil
+	}
+
+	plaintext, err := unpad(data, decrypt.BlockSize())
+	if err != nil {
+		return nil, err
+	}
+
+	return dst[:n+len(plaintext)], nil
 }
 
 func (v *Vault) generateSalt(size uint) ([]byte, error) {
-	rawSalt, err := randBits(v.opts.Encryption.SaltBits)
+	var rawSalt []byte
+	var err error
+	if v.opts.SaltSource != nil {
+		rawSalt, err = v.opts.SaltSource(size)
+		if err == nil && uint(len(rawSalt)) != size {
+			err = fmt.Errorf("iron-go: salt source returned %d bytes, expected %d", len(rawSalt), size)
+		}
+	} else {
+		rawSalt, err = v.randomBytes(size)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -154,9 +652,25 @@ func (v *Vault) generateSalt(size uint) ([]byte, error) {
 	return salt, nil
 }
 
-func (v *Vault) encryptBlocks(block cipher.BlockMode, b []byte) []byte {
+// encryptBlocks pads and encrypts the plaintext. Like PKCS#7, it always adds
+// padding, so plaintext which is already block-aligned gains a full block.
+func (v *Vault) encryptBlocks(block cipher.BlockMode, plaintext []byte) []byte {
+	return encryptPadded(block, plaintext, v.opts.Encryption.LegacyTabPadding)
+}
+
+// encryptPadded pads and encrypts the plaintext with PKCS#7 padding, or with
+// the legacy tab padding if legacy is set.
+func encryptPadded(block cipher.BlockMode, plaintext []byte, legacy bool) []byte {
 	size := block.BlockSize()
-	b = append(b, bytes.Repeat([]byte{padder}, size-len(b)%size)...)
+	n := size - len(plaintext)%size
+	pad := byte(n)
+	if legacy {
+		pad = padder
+	}
+
+	b := make([]byte, len(plaintext)+n)
+	copy(b, plaintext)
+	copy(b[len(plaintext):], bytes.Repeat([]byte{pad}, n))
 	out := make([]byte, len(b))
 
 	for i := 0; i < len(b); i += size {
@@ -166,94 +680,699 @@ func (v *Vault) encryptBlocks(block cipher.BlockMode, b []byte) []byte {
 	return out
 }
 
-func (v *Vault) encrypt(b []byte) (*message, error) {
-	salt, err := v.generateSalt(v.opts.Encryption.SaltBits)
-	if err != nil {
-		return nil, err
+// unpad strips and verifies PKCS#7 padding from the decrypted data. It
+// returns an UnsealError if the padding is invalid.
+func unpad(data []byte, size int) ([]byte, error) {
+	if len(data) == 0 || len(data)%size != 0 {
+		return nil, UnsealError{"Invalid padding"}
 	}
 
-	key := v.generateKey(v.opts.Encryption.KeyBits, v.opts.Encryption.Iterations, salt)
-	iv, err := randBits(v.opts.Encryption.IVBits)
+	n := int(data[len(data)-1])
+	if n == 0 || n > size {
+		return nil, UnsealError{"Invalid padding"}
+	}
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, UnsealError{"Invalid padding"}
+		}
+	}
+
+	return data[:len(data)-n], nil
+}
+
+func (v *Vault) encrypt(msg *message, b []byte) error {
+	if v.opts.verifyOnly() {
+		return ErrVerifyOnly
+	}
+	var salt []byte
+	var err error
+	if v.session != nil {
+		salt = v.session.encSalt
+	} else if salt, err = v.generateSalt(v.opts.Encryption.SaltBits); err != nil {
+		return err
+	}
+
+	key, err := v.generateKey(encryptionKey, v.opts.Encryption.derivedKeyBits(), v.opts.Encryption.Iterations, salt)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	var iv []byte
+	if v.session != nil && v.session.ivs != nil {
+		iv, err = v.session.ivs.next(v.opts.Encryption.Cipher, key)
+	} else {
+		iv, err = v.randomBytes(v.opts.Encryption.IVBits)
+	}
+	if err != nil {
+		return err
+	}
+	if v.opts.IVReuseDetector != nil && v.opts.IVReuseDetector.check(iv) {
+		return ErrIVReuse
 	}
 
 	encrypt, _, err := v.opts.Encryption.Cipher(key, iv)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &message{
-		EncryptedBody: v.encryptBlocks(encrypt, b),
-		IV:            iv,
-		Salt:          salt,
-	}, nil
+	msg.EncryptedBody = v.encryptBlocks(encrypt, b)
+	msg.IV = iv
+	msg.Salt = salt
+	return nil
+}
+
+// messageHasher generates the message's HMAC salt, or takes the session's,
+// and returns the hasher keyed by it, having set any key check value.
+func (v *Vault) messageHasher(msg *message) (hash.Hash, error) {
+	var hmacSalt []byte
+	var err error
+	if v.session != nil {
+		hmacSalt = v.session.intSalt
+	} else if hmacSalt, err = v.generateSalt(v.opts.Integrity.SaltBits); err != nil {
+		return nil, err
+	}
+	h, err := v.integrityHasher(hmacSalt)
+	if err != nil {
+		return nil, err
+	}
+	if v.opts.IncludeKCV {
+		msg.KCV = keyCheckValue(h)
+	}
+	msg.HMACSalt = hmacSalt
+	return h, nil
 }
 
 // Unseal attempts to extract the encrypted information from the message.
 // It takes some options, or nil to use defaults. It returns an
 // UnsealError if the message is invalid.
 func (v *Vault) Unseal(str string) ([]byte, error) {
-	msg := &message{}
-	if err := msg.Unpack(str); err != nil {
+	_, payload, err := v.unsealFor("", nil, str)
+	return payload, err
+}
+
+// UnsealAppend unseals the cookie like Unseal, appending the payload to
+// dst and returning the extended slice, so that a buffer can be reused
+// across calls. Cookies are decrypted straight into dst's spare capacity
+// unless their payload must be decompressed, transformed or otherwise
+// undone, which allocates as Unseal does. On error, it returns dst
+// unchanged with the UnsealError.
+func (v *Vault) UnsealAppend(dst []byte, sealed string) ([]byte, error) {
+	msg, v, err := v.verify(sealed, nil)
+	if err != nil {
+		return dst, err
+	}
+	if msg.Purpose != "" {
+		return dst, UnsealError{"Purpose mismatch"}
+	}
+	if msg.decrypted == nil && v.rawPayload(msg) {
+		out, err := v.decryptAppend(dst, msg)
+		if err != nil {
+			return dst, err
+		}
+		return out, nil
+	}
+
+	payload, err := v.open(msg)
+	if err != nil {
+		return dst, err
+	}
+
+	return append(dst, payload...), nil
+}
+
+// UnsealString unseals a text payload like Unseal. If the payload isn't
+// valid UTF-8, it returns a PayloadError carrying the payload.
+func (v *Vault) UnsealString(str string) (string, error) {
+	payload, err := v.Unseal(str)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(payload) {
+		return "", PayloadError{payload, UnsealError{"Decrypted payload is not valid UTF-8"}}
+	}
+
+	return string(payload), nil
+}
+
+// UnsealJSON unseals a JSON payload like Unseal, and decodes it into the
+// target with json.Unmarshal. If decoding fails, it returns a PayloadError
+// carrying the payload.
+func (v *Vault) UnsealJSON(str string, target interface{}) error {
+	payload, err := v.Unseal(str)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(payload, target); err != nil {
+		return PayloadError{payload, err}
+	}
+
+	return nil
+}
+
+// SamePlaintext reports whether the two cookies wrap the same payload,
+// without returning either payload. Both must unseal; otherwise the error
+// unsealing the first that fails is returned. The payloads are compared in
+// constant time, although payloads of different lengths differ at once.
+func (v *Vault) SamePlaintext(a, b string) (bool, error) {
+	pa, err := v.Unseal(a)
+	if err != nil {
+		return false, err
+	}
+	pb, err := v.Unseal(b)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(pa, pb) == 1, nil
+}
+
+// VerifyPlaintext reports whether the cookie wraps the candidate, as when
+// checking a user-provided value against a stored sealed secret, without
+// returning the stored payload. The cookie must unseal, so a tampered
+// cookie gives an error rather than false. The comparison is constant time,
+// although payloads of different lengths differ at once.
+func (v *Vault) VerifyPlaintext(sealed string, candidate []byte) (bool, error) {
+	payload, err := v.Unseal(sealed)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(payload, candidate) == 1, nil
+}
+
+// UnsealWithInfo unseals a cookie like Unseal, and also returns information
+// about how it was sealed.
+func (v *Vault) UnsealWithInfo(sealed string) ([]byte, SealInfo, error) {
+	msg, payload, err := v.unsealFor("", nil, sealed)
+	if err != nil {
+		return nil, SealInfo{}, err
+	}
+
+	return payload, msg.info(), nil
+}
+
+// UnsealMinTTL unseals a cookie like Unseal, but also returns an
+// UnsealError if it expires within minRemaining, such as to require a fresh
+// login before a sensitive multi-step flow. Cookies which don't expire
+// always have enough lifetime.
+func (v *Vault) UnsealMinTTL(sealed string, minRemaining time.Duration) ([]byte, error) {
+	msg, payload, err := v.unsealFor("", nil, sealed)
+	if err != nil {
 		return nil, err
 	}
+	if !msg.Expiration.IsZero() && msg.Expiration.Sub(time.Now().Add(v.opts.LocalTimeOffset)) < minRemaining {
+		return nil, UnsealError{"Insufficient remaining lifetime"}
+	}
 
-	// 1. Check expiration
+	return payload, nil
+}
+
+// UnsealFor unseals a cookie which was sealed by SealFor with the same
+// purpose. It returns an UnsealError if the purposes differ.
+func (v *Vault) UnsealFor(purpose, sealed string) ([]byte, error) {
+	_, payload, err := v.unsealFor(purpose, nil, sealed)
+	return payload, err
+}
+
+// unsealFor unseals the string like unseal, additionally verifying that it
+// was sealed for the purpose. Cookies sealed without a purpose have the
+// empty purpose.
+func (v *Vault) unsealFor(purpose string, aad []byte, str string) (*message, []byte, error) {
+	msg, payload, err := v.unseal(str, aad)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(msg.Purpose), []byte(purpose)) == 0 {
+		return nil, nil, UnsealError{"Purpose mismatch"}
+	}
+
+	return msg, payload, nil
+}
+
+// unseal verifies and decrypts the sealed string, which must have been
+// sealed with the additional data, returning both the unpacked message and
+// its decrypted payload.
+func (v *Vault) unseal(str string, aad []byte) (*message, []byte, error) {
+	msg, v, err := v.verify(str, aad)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 4. Decrypt!
+
+	payload, err := v.open(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return msg, payload, nil
+}
 
-	if !msg.Expiration.IsZero() {
-		delta := msg.Expiration.Sub(time.Now().Add(v.opts.LocalTimeOffset))
-		if delta < -v.opts.TimestampSkew {
-			return nil, UnsealError{"Expired or invalid seal"}
+// open decrypts the verified message and undoes the steps applied to its
+// payload before encryption. If the message's expiration is encrypted, it
+// reads and checks it.
+func (v *Vault) open(msg *message) ([]byte, error) {
+	var err error
+	payload := msg.decrypted
+	if payload == nil {
+		if payload, err = v.decrypt(msg); err != nil {
+			return nil, err
+		}
+	}
+	if msg.padded {
+		if payload, err = unpadMultiple(payload); err != nil {
+			return nil, err
+		}
+	}
+	if msg.expirationEncrypted {
+		if msg.Expiration, payload, err = splitExpiration(payload); err != nil {
+			return nil, err
 		}
+		if err := v.checkExpiration(msg.Expiration); err != nil {
+			return nil, err
+		}
+	}
+	if payload, err = decompress(msg, payload, v.opts.MaxPlaintextSize); err != nil {
+		return nil, err
+	}
+
+	return v.transformBackward(msg, payload)
+}
+
+// rawPayload reports whether the message's payload is its decrypted body,
+// with nothing for open to undo.
+func (v *Vault) rawPayload(msg *message) bool {
+	return !msg.padded && !msg.expirationEncrypted &&
+		!msg.Compressed && msg.Transforms == ""
+}
+
+// checkExpiration returns an UnsealError matching ErrExpired if the expiration, allowing for
+// skew, has passed. A zero expiration never passes.
+func (v *Vault) checkExpiration(expiration time.Time) error {
+	if expiration.IsZero() {
+		return nil
+	}
+
+	delta := expiration.Sub(time.Now().Add(v.opts.LocalTimeOffset))
+	if delta < -(v.opts.TimestampSkew + v.expiryGrace) {
+		return expiredError(-delta, v.opts.TimestampSkew)
+	}
+
+	return nil
+}
+
+// verify unpacks the sealed string and checks its expiration and HMAC,
+// which must cover the additional data. It returns the message and the
+// vault which holds the secret it was sealed with, ready for decryption.
+func (v *Vault) verify(str string, aad []byte) (*message, *Vault, error) {
+	if err := v.checkZeroized(); err != nil {
+		return nil, nil, err
+	}
+	if v.opts.FastReject {
+		var err error
+		if str, err = v.checkFastTag(str); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	msg := &message{}
+	if err := msg.Unpack(str, &v.opts); err != nil {
+		return nil, nil, err
+	}
+	if v.opts.RevokedPasswordIDs[msg.PasswordID] {
+		return nil, nil, UnsealError{"Password revoked"}
+	}
+	if v.session != nil && v.session.fixedIntSalt && !bytes.Equal(msg.HMACSalt, v.session.intSalt) {
+		return nil, nil, UnsealError{"Unexpected integrity salt"}
+	}
+	if v.opts.Secrets != nil {
+		var err error
+		if v, err = v.lookupSecret(msg.PasswordID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 1. Check expiration
+
+	if err := v.checkExpiration(msg.Expiration); err != nil {
+		return nil, nil, err
 	}
 
 	// 2. Run the MAC digest against the message excluding our additional
-	// salt and hmac
+	// salt and hmac. Any key check value is compared first. In
+	// MAC-then-encrypt mode, the message must be decrypted first, and the
+	// HMAC is read from the end of the plaintext. If decryption fails, the
+	// HMAC is still computed, over the ciphertext in place of the
+	// plaintext, and the failure reported as a bad HMAC, though the timing
+	// of decryption may still differ.
 
-	digest, err := v.hmacWithPassword(msg.HMACSalt, msg.Base())
+	h, err := v.integrityHasher(msg.HMACSalt)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if msg.KCV != nil && !hmac.Equal(msg.KCV, keyCheckValue(h)) {
+		return nil, nil, UnsealError{"Wrong secret"}
 	}
 
+	var plaintext []byte
+	expected, decrypted := msg.HMAC, true
+	if v.opts.MACOrder == MACThenEncrypt {
+		var err error
+		if plaintext, err = v.decrypt(msg); err == ErrVerifyOnly {
+			return nil, nil, err
+		} else if err != nil || len(plaintext) < h.Size() || len(msg.HMAC) != 0 {
+			plaintext, decrypted = msg.EncryptedBody, false
+			expected = make([]byte, h.Size())
+		} else {
+			n := len(plaintext) - h.Size()
+			plaintext, expected = plaintext[:n:n], plaintext[n:]
+		}
+	}
+	io.WriteString(h, v.macData(msg, aad, plaintext))
+	digest := h.Sum(nil)
+
 	// 3. Check the HMAC
 
-	if subtle.ConstantTimeCompare(digest, msg.HMAC) == 0 {
-		return nil, UnsealError{"Bad hmac value"}
+	if subtle.ConstantTimeCompare(digest, expected) == 0 || !decrypted {
+		return nil, nil, UnsealError{"Bad hmac value"}
+	}
+	if msg.Parameters != "" && msg.Parameters != v.Describe().parameters() {
+		return nil, nil, UnsealError{"Sealed parameters do not match the vault"}
+	}
+	if len(v.opts.AcceptedIssuers) > 0 && !listed(v.opts.AcceptedIssuers, msg.Issuer) {
+		return nil, nil, UnsealError{"Untrusted issuer"}
 	}
+	if len(v.opts.AcceptedAudiences) > 0 && !listed(v.opts.AcceptedAudiences, msg.Audience) {
+		return nil, nil, UnsealError{"Audience not accepted"}
+	}
+	v.warnForwardCompat(msg)
+	msg.decrypted = plaintext
 
-	// 4. Decrypt!
+	return msg, v, nil
+}
+
+// macData returns the data to MAC for the message, additional data and, in
+// MAC-then-encrypt mode, the plaintext passed to the cipher.
+func (v *Vault) macData(msg *message, aad, plaintext []byte) string {
+	if v.opts.MACOrder != MACThenEncrypt {
+		return macInput(msg.Base(), aad)
+	}
+
+	return macInput(msg.plaintextBase(), aad) + "\x00" + string(plaintext)
+}
+
+// listed reports whether the value, which may not be empty, is in the
+// list, such as Options.AcceptedIssuers.
+func listed(list []string, value string) bool {
+	for _, accepted := range list {
+		if value != "" && value == accepted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PayloadSize verifies the sealed cookie like Unseal, and returns the length
+// of its payload. Rather than decrypting the whole body, it decrypts only the
+// final block to read its PKCS#7 padding, which relies on the cipher being
+// in CBC mode like the built-in ciphers. Compressed, transformed or padded
+// payloads, and those with encrypted expirations, are decrypted and restored
+// in full.
+func (v *Vault) PayloadSize(sealed string) (int, error) {
+	msg, v, err := v.verify(sealed, nil)
+	if err != nil {
+		return 0, err
+	}
+	if v.opts.verifyOnly() {
+		return 0, ErrVerifyOnly
+	}
+	if v.opts.Encryption.LegacyTabPadding || v.opts.MACOrder == MACThenEncrypt || !v.rawPayload(msg) {
+		payload, err := v.open(msg)
+		return len(payload), err
+	}
+
+	key, err := v.generateKey(encryptionKey, v.opts.Encryption.derivedKeyBits(), v.opts.Encryption.Iterations, msg.Salt)
+	if err != nil {
+		return 0, err
+	}
+
+	// In CBC mode, each block is chained to the ciphertext of the block
+	// before it, or to the IV for the first block.
+	body := msg.EncryptedBody
+	size := len(msg.IV)
+	if size == 0 || len(body) == 0 || len(body)%size != 0 {
+		return 0, UnsealError{"Invalid padding"}
+	}
+	iv := msg.IV
+	if len(body) > size {
+		iv = body[len(body)-2*size : len(body)-size]
+	}
+
+	_, decrypt, err := v.opts.Encryption.Cipher(key, iv)
+	if err != nil {
+		return 0, err
+	}
+
+	last := make([]byte, size)
+	decrypt.CryptBlocks(last, body[len(body)-size:])
+	unpadded, err := unpad(last, size)
+	if err != nil {
+		return 0, err
+	}
 
-	return v.decrypt(msg)
+	return len(body) - size + len(unpadded), nil
 }
 
-// Seal encrypts and signs the byte slice into an Iron cookie.
+// Seal encrypts and signs the byte slice into an Iron cookie. Sealing a nil
+// or empty slice is permitted, and unseals to an empty, non-nil slice.
 func (v *Vault) Seal(b []byte) (string, error) {
+	return v.sealPayload(v.newMessage(), b)
+}
 
-	// 1. Encrypt the payload
+// sealKey seals a random key, such as a content key, for features built on
+// Seal. It isn't a caller's payload, so it isn't normalized.
+func (v *Vault) sealKey(key []byte) (string, error) {
+	return v.seal(v.newMessage(), key)
+}
 
-	msg, err := v.encrypt(b)
+// SealWithInfo seals the payload like Seal, and also returns information
+// about how it was sealed, such as the ID of the password used.
+func (v *Vault) SealWithInfo(b []byte) (string, SealInfo, error) {
+	msg := v.newMessage()
+	sealed, err := v.sealPayload(msg, b)
 	if err != nil {
-		return "", err
+		return "", SealInfo{}, err
+	}
+
+	return sealed, msg.info(), nil
+}
+
+// SealWithHeader seals the payload like Seal, and additionally embeds the
+// header as a cleartext component. The header is authenticated but not
+// encrypted: anyone may read it via ParseSeal, but it can't be altered
+// without invalidating the seal. Cookies with headers can't be read by Node
+// Iron.
+func (v *Vault) SealWithHeader(header, payload []byte) (string, error) {
+	msg := v.newMessage()
+	msg.Header = header
+	if msg.Header == nil {
+		msg.Header = []byte{}
+	}
+
+	return v.sealPayload(msg, payload)
+}
+
+// SealWithAAD seals the payload like Seal, binding it to the additional
+// data, such as a digest of attributes of the client it's issued to. The
+// additional data is authenticated but not included in the cookie: it can
+// only be unsealed by UnsealWithAAD with the same additional data.
+func (v *Vault) SealWithAAD(aad, b []byte) (string, error) {
+	msg := v.newMessage()
+	msg.aad = aad
+	return v.sealPayload(msg, b)
+}
+
+// UnsealWithAAD unseals a cookie which was sealed by SealWithAAD with the
+// same additional data. It returns an UnsealError if they differ.
+func (v *Vault) UnsealWithAAD(aad []byte, sealed string) ([]byte, error) {
+	_, payload, err := v.unsealFor("", aad, sealed)
+	return payload, err
+}
+
+// UnsealWithHeader unseals a cookie like Unseal, and also returns the header
+// it was sealed with, or nil if it was sealed without one.
+func (v *Vault) UnsealWithHeader(sealed string) (header, payload []byte, err error) {
+	msg, payload, err := v.unsealFor("", nil, sealed)
+	if err != nil {
+		return nil, nil, err
 	}
+
+	return msg.Header, payload, nil
+}
+
+// newMessage returns a message to be sealed, with its expiration and
+// issued-at time set according to the options.
+func (v *Vault) newMessage() *message {
+	msg := &message{}
+	now := time.Now()
 	if v.opts.TTL > 0 {
-		msg.Expiration = time.Now().Add(v.opts.TTL)
+		msg.Expiration = now.Add(v.opts.TTL)
+	}
+	if v.opts.EmbedIssuedAt {
+		msg.IssuedAt = now
 	}
+	if v.opts.EmbedTTL {
+		msg.TTL = v.opts.TTL
+	}
+	msg.Issuer = v.opts.Issuer
+	msg.Audience = v.opts.Audience
 
-	// 2. Generate an HMAC signature
+	return msg
+}
+
+// SealFor seals the payload like Seal, binding it to the purpose, such as
+// "password-reset". The purpose is authenticated cleartext: the cookie can
+// only be unsealed by UnsealFor with the same purpose, and not by Unseal.
+func (v *Vault) SealFor(purpose string, b []byte) (string, error) {
+	msg := v.newMessage()
+	msg.Purpose = purpose
+	return v.sealPayload(msg, b)
+}
 
-	hmacSalt, err := v.generateSalt(v.opts.Integrity.SaltBits)
+// Reseal unseals the cookie and seals its payload again with fresh salts and
+// IV, preserving its original expiration, header, purpose and audience. The
+// issuer is this vault's own Options.Issuer, since the vault can't vouch
+// for another's. If the cookie was sealed with EmbedTTL, its window is
+// refreshed instead: it expires the original TTL from now. It returns an
+// UnsealError if the cookie is invalid.
+//
+// Cookies which expired less than Options.RenewalGrace ago are renewed
+// rather than rejected, expiring the vault's TTL from now, unless they're
+// older than Options.RenewalMaxAge. Expired cookies aren't renewed by a
+// vault without a TTL, since they'd have no fresh expiration.
+func (v *Vault) Reseal(sealed string) (string, error) {
+	grace := *v
+	grace.expiryGrace = v.opts.RenewalGrace
+	old, payload, err := grace.unseal(sealed, nil)
 	if err != nil {
 		return "", err
 	}
-	digest, err := v.hmacWithPassword(hmacSalt, msg.Base())
+
+	expired := v.checkExpiration(old.Expiration)
+	if expired != nil && v.opts.RenewalMaxAge > 0 &&
+		(old.IssuedAt.IsZero() || time.Since(old.IssuedAt) > v.opts.RenewalMaxAge) {
+		return "", expired
+	}
+
+	msg := &message{
+		Expiration: old.Expiration,
+		IssuedAt:   old.IssuedAt,
+		TTL:        old.TTL,
+		Header:     old.Header,
+		Purpose:    old.Purpose,
+		Issuer:     v.opts.Issuer,
+		Audience:   old.Audience,
+	}
+	switch {
+	case old.TTL > 0:
+		msg.Expiration = time.Now().Add(old.TTL)
+	case expired != nil && v.opts.TTL > 0:
+		msg.Expiration = time.Now().Add(v.opts.TTL)
+	case expired != nil:
+		return "", expired
+	}
+
+	return v.seal(msg, payload)
+}
+
+// sealPayload seals the caller's payload into the message like seal, after
+// normalizing it with the Normalizer, if any.
+func (v *Vault) sealPayload(msg *message, b []byte) (string, error) {
+	if v.opts.Normalizer != nil {
+		var err error
+		if b, err = v.opts.Normalizer(b); err != nil {
+			return "", err
+		}
+	}
+
+	return v.seal(msg, b)
+}
+
+// seal encrypts and signs the byte slice into the message, whose cleartext
+// metadata such as its expiration should already be populated, and returns
+// the packed result.
+func (v *Vault) seal(msg *message, b []byte) (string, error) {
+	if err := v.checkZeroized(); err != nil {
+		return "", err
+	}
+	if v.opts.Secrets != nil {
+		var err error
+		if msg.PasswordID, v, err = v.currentSecret(); err != nil {
+			return "", err
+		}
+	}
+
+	if v.opts.MaxPlaintextSize > 0 && len(b) > v.opts.MaxPlaintextSize {
+		return "", ErrPayloadTooLarge
+	}
+	if v.opts.EmbedParameters {
+		msg.Parameters = v.Describe().parameters()
+	}
+	msg.prefix = v.opts.sealPrefix()
+	msg.resolution = v.opts.ExpirationResolution
+
+	// 1. Encrypt the payload
+
+	b, err := v.transformForward(msg, b)
 	if err != nil {
 		return "", err
 	}
+	if b, err = v.compress(msg, b); err != nil {
+		return "", err
+	}
+	if v.opts.EncryptExpiration {
+		b = joinExpiration(msg.Expiration, b)
+		msg.expirationEncrypted = true
+	}
+	if v.opts.Encryption.PadToMultiple > 0 {
+		b = padToMultiple(b, v.opts.Encryption.PadToMultiple)
+		msg.padded = true
+	}
+	if v.opts.EmbedIssuedAt && msg.IssuedAt.IsZero() {
+		msg.IssuedAt = time.Now()
+	}
+	if v.opts.MACOrder == MACThenEncrypt {
+		// The HMAC is encrypted after the plaintext, so it's computed
+		// first, over a base without the salt, IV and body. The plaintext
+		// may be the caller's, so the HMAC mustn't be appended in place.
+		h, err := v.messageHasher(msg)
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, v.macData(msg, msg.aad, b))
+		b = h.Sum(b[:len(b):len(b)])
+	}
+	if err := v.encrypt(msg, b); err != nil {
+		return "", err
+	}
+
+	// 2. Generate an HMAC signature
+
+	if v.opts.MACOrder != MACThenEncrypt {
+		h, err := v.messageHasher(msg)
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, v.macData(msg, msg.aad, b))
+		msg.HMAC = h.Sum(nil)
+	}
 
 	// 3. Generate the packed result
 
-	msg.HMACSalt = hmacSalt
-	msg.HMAC = digest
-	return msg.Pack(), nil
+	packed := msg.Pack(&v.opts)
+	if v.opts.FastReject {
+		packed = v.fastTag(packed) + delimiter + packed
+	}
+
+	return packed, nil
 }
@@ -1,11 +1,24 @@
 package iron
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/hkdf"
 )
 
 var (
@@ -71,7 +84,9 @@ func TestSealsWithExpiration(t *testing.T) {
 
 	v2 := New(Options{Secret: password, TTL: time.Hour, LocalTimeOffset: time.Hour * 2})
 	_, err = v2.Unseal(cookie)
-	assert.Equal(t, UnsealError{"Expired or invalid seal"}, err)
+	assert.True(t, errors.Is(err, ErrExpired))
+	assert.IsType(t, UnsealError{}, err)
+	assert.Regexp(t, `^Expired 1h0m0(\.\d+)?s ago \(skew 1m0s\)$`, err.Error())
 }
 
 func TestSealsWithExpirationAndTimeShift(t *testing.T) {
@@ -95,7 +110,7 @@ func TestSealsWithExpirationAndTimeShift(t *testing.T) {
 	v2.opts.LocalTimeOffset = time.Hour + 61*time.Second
 
 	_, err = v2.Unseal(cookie)
-	assert.Equal(t, UnsealError{"Expired or invalid seal"}, err)
+	assert.True(t, errors.Is(err, ErrExpired))
 }
 
 func TestUnsealsTicket(t *testing.T) {
@@ -105,6 +120,63 @@ func TestUnsealsTicket(t *testing.T) {
 	assert.Equal(t, "{\"a\":1,\"b\":2,\"c\":[3,4,5],\"d\":{\"e\":\"f\"}}", string(payload))
 }
 
+func TestUnsealsStrings(t *testing.T) {
+	v := New(Options{Secret: password})
+	cookie, err := v.Seal([]byte("héllo, wörld"))
+	assert.Nil(t, err)
+	str, err := v.UnsealString(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, "héllo, wörld", str)
+
+	cookie, err = v.Seal([]byte{0xff, 0xfe, 0x00, 0x80})
+	assert.Nil(t, err)
+	_, err = v.UnsealString(cookie)
+	assert.Equal(t, PayloadError{[]byte{0xff, 0xfe, 0x00, 0x80}, UnsealError{"Decrypted payload is not valid UTF-8"}}, err)
+	assert.Equal(t, "Decrypted payload is not valid UTF-8", err.Error())
+
+	_, err = v.UnsealString("Fe27.2**a*b*c**d*e")
+	assert.Equal(t, UnsealError{"Wrong mac prefix"}, err)
+}
+
+func TestUnsealsJSON(t *testing.T) {
+	v := New(Options{Secret: password})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	var decoded struct{ A int }
+	assert.Nil(t, v.UnsealJSON(cookie, &decoded))
+	assert.Equal(t, 1, decoded.A)
+
+	cookie, err = v.Seal([]byte(`{"a":`))
+	assert.Nil(t, err)
+	err = v.UnsealJSON(cookie, &decoded)
+	assert.IsType(t, PayloadError{}, err)
+	assert.Equal(t, []byte(`{"a":`), err.(PayloadError).Payload)
+
+	err = v.UnsealJSON(strings.Replace(cookie, "**", "*x*", 1), &decoded)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestJoinsBaseAndIntegrityWithSingleDelimiter(t *testing.T) {
+	// Node's ticket has no TTL, so its expiration is empty.
+	ticket := "Fe26.2**0cdd607945dd1dffb7da0b0bf5f1a7daa6218cbae14cac51dcbd91fb077aeb5b*aOZLCKLhCt0D5IU1qLTtYw*g0ilNDlQ3TsdFUqJCqAm9iL7Wa60H7eYcHL_5oP136TOJREkS3BzheDC1dlxz5oJ**05b8943049af490e913bbc3a2485bee2aaf7b823f4c41d0ff0b7c168371a3772*R8yscVdTBRMdsoVbdDiFmUL8zb-c3PQLGJn4Y8C-AqI"
+	msg := &message{}
+	assert.Nil(t, msg.Unpack(ticket, &Options{}))
+	assert.Equal(t, "Fe26.2**0cdd607945dd1dffb7da0b0bf5f1a7daa6218cbae14cac51dcbd91fb077aeb5b*aOZLCKLhCt0D5IU1qLTtYw*g0ilNDlQ3TsdFUqJCqAm9iL7Wa60H7eYcHL_5oP136TOJREkS3BzheDC1dlxz5oJ*", msg.Base())
+
+	// Rebuilding the base from the components gives the same string.
+	rebuilt := *msg
+	rebuilt.base = ""
+	assert.Equal(t, msg.Base(), rebuilt.Base())
+	assert.Equal(t, ticket, rebuilt.Pack(&Options{}))
+
+	// With an expiration there's no double delimiter before the salt.
+	cookie, err := New(Options{Secret: password, TTL: time.Hour}).Seal(source)
+	assert.Nil(t, err)
+	parts := strings.Split(cookie, delimiter)
+	assert.Len(t, parts, 8)
+	assert.NotEmpty(t, parts[5])
+}
+
 func TestReturnsErrWithWrongUnseals(t *testing.T) {
 	v := New(Options{Secret: password})
 	_, err := v.Unseal("x*Fe26.2**a6dc6339e5ea5dfe7a135631cf3b7dcf47ea38246369d45767c928ea81781694*D3DLEoi-Hn3c972TPpZXqw*mCBhmhHhRKk9KtBjwu3h-1lx1MHKkgloQPKRkQZxpnDwYnFkb3RqdVTQRcuhGf4M**ff2bf988aa0edf2b34c02d220a45c4a3c572dac6b995771ed20de58da919bfa5*HfWzyJlz_UP9odmXvUaVK1TtdDuOCaezr-TAg2GjBCU")
@@ -129,6 +201,40 @@ func TestReturnsErrOnBase64Fail(t *testing.T) {
 	assert.Equal(t, UnsealError{"Invalid component encoding"}, err)
 }
 
+func TestReturnsErrOnMissingSalt(t *testing.T) {
+	v := New(Options{Secret: password})
+	_, err := v.Unseal("Fe26.2***aOZLCKLhCt0D5IU1qLTtYw*g0ilNDlQ3TsdFUqJCqAm9iL7Wa60H7eYcHL_5oP136TOJREkS3BzheDC1dlxz5oJ**05b8943049af490e913bbc3a2485bee2aaf7b823f4c41d0ff0b7c168371a3772*R8yscVdTBRMdsoVbdDiFmUL8zb-c3PQLGJn4Y8C-AqI")
+	assert.Equal(t, UnsealError{"Missing salt"}, err)
+
+	_, err = v.Unseal("Fe26.2**0cdd607945dd1dffb7da0b0bf5f1a7daa6218cbae14cac51dcbd91fb077aeb5b*aOZLCKLhCt0D5IU1qLTtYw*g0ilNDlQ3TsdFUqJCqAm9iL7Wa60H7eYcHL_5oP136TOJREkS3BzheDC1dlxz5oJ***R8yscVdTBRMdsoVbdDiFmUL8zb-c3PQLGJn4Y8C-AqI")
+	assert.Equal(t, UnsealError{"Missing salt"}, err)
+
+	long := strings.Repeat("a", maxSaltLength+1)
+	_, err = v.Unseal("Fe26.2**" + long + "*aOZLCKLhCt0D5IU1qLTtYw*g0ilNDlQ3TsdFUqJCqAm9iL7Wa60H7eYcHL_5oP136TOJREkS3BzheDC1dlxz5oJ**05b8943049af490e913bbc3a2485bee2aaf7b823f4c41d0ff0b7c168371a3772*R8yscVdTBRMdsoVbdDiFmUL8zb-c3PQLGJn4Y8C-AqI")
+	assert.Equal(t, UnsealError{"Invalid salt length"}, err)
+}
+
+func TestChecksSaltLengthStrictly(t *testing.T) {
+	v := New(Options{Secret: password, StrictSaltLength: true})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	// Node's ticket has 64-character hex salts.
+	ticket := "Fe26.2**0cdd607945dd1dffb7da0b0bf5f1a7daa6218cbae14cac51dcbd91fb077aeb5b*aOZLCKLhCt0D5IU1qLTtYw*g0ilNDlQ3TsdFUqJCqAm9iL7Wa60H7eYcHL_5oP136TOJREkS3BzheDC1dlxz5oJ**05b8943049af490e913bbc3a2485bee2aaf7b823f4c41d0ff0b7c168371a3772*R8yscVdTBRMdsoVbdDiFmUL8zb-c3PQLGJn4Y8C-AqI"
+	_, err = v.Unseal(ticket)
+	assert.Equal(t, UnsealError{"Unexpected salt length"}, err)
+	_, err = New(Options{Secret: password}).Unseal(ticket)
+	assert.Nil(t, err)
+
+	parts := strings.Split(cookie, delimiter)
+	parts[6] = parts[6][1:]
+	_, err = v.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Unexpected salt length"}, err)
+}
+
 func TestReturnsErrOnExpired(t *testing.T) {
 	v := New(Options{Secret: password})
 
@@ -140,5 +246,1029 @@ func TestReturnsErrOnExpired(t *testing.T) {
 		base64.RawURLEncoding.EncodeToString(salt) + "*" +
 		base64.RawURLEncoding.EncodeToString(mac))
 
-	assert.Equal(t, UnsealError{"Expired or invalid seal"}, err)
+	assert.True(t, errors.Is(err, ErrExpired))
+	assert.IsType(t, UnsealError{}, err)
+}
+
+func TestSealsWithOmittedPrefix(t *testing.T) {
+	v := New(Options{Secret: password, OmitPrefix: true})
+
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	assert.False(t, strings.HasPrefix(cookie, macPrefix))
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = New(Options{Secret: password}).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Incorrect number of sealed components"}, err)
+}
+
+func TestOmittedPrefixAuthenticatesCanonicalBase(t *testing.T) {
+	v := New(Options{Secret: password})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	stripped := New(Options{Secret: password, OmitPrefix: true})
+	payload, err := stripped.Unseal(strings.TrimPrefix(cookie, macPrefix+delimiter))
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = stripped.Unseal(cookie)
+	assert.Equal(t, UnsealError{"Incorrect number of sealed components"}, err)
+}
+
+func TestSealsEmptyPayloads(t *testing.T) {
+	v := New(Options{Secret: password})
+
+	for _, input := range [][]byte{nil, {}} {
+		cookie, err := v.Seal(input)
+		assert.Nil(t, err)
+		payload, err := v.Unseal(cookie)
+		assert.Nil(t, err)
+		assert.NotNil(t, payload)
+		assert.Equal(t, []byte{}, payload)
+	}
+}
+
+func TestSealsForSubject(t *testing.T) {
+	v := New(Options{Secret: password})
+	alice := v.ForSubject([]byte("alice"))
+
+	cookie, err := alice.Seal(source)
+	assert.Nil(t, err)
+
+	payload, err := v.ForSubject([]byte("alice")).Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = v.ForSubject([]byte("bob")).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+	_, err = v.Unseal(cookie)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestSealsForSubjectWithIntegritySecret(t *testing.T) {
+	v := New(Options{Secret: password, IntegritySecret: rawKey})
+	cookie, err := v.ForSubject([]byte("alice")).Seal(source)
+	assert.Nil(t, err)
+
+	payload, err := v.ForSubject([]byte("alice")).Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = v.ForSubject([]byte("bob")).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+	_, err = v.Unseal(cookie)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestDerivesSubjectSecretFromLongSecret(t *testing.T) {
+	secret := bytes.Repeat([]byte{'s'}, 9000)
+	derived := deriveSubjectSecret(secret, []byte("alice"))
+	expected := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte("alice")), expected)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, derived)
+
+	v := New(Options{Secret: secret}).ForSubject([]byte("alice"))
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+}
+
+func TestUnsealsWithExtraComponents(t *testing.T) {
+	cookie, err := New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+	extended := cookie + delimiter + "future"
+
+	_, err = New(Options{Secret: password}).Unseal(extended)
+	assert.Equal(t, UnsealError{"Incorrect number of sealed components"}, err)
+
+	v := New(Options{Secret: password, AllowExtraComponents: true})
+	payload, err := v.Unseal(extended)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	parts := strings.Split(extended, delimiter)
+	parts[4] = parts[4][1:]
+	_, err = v.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestUnsealsWithMinimumRemainingLifetime(t *testing.T) {
+	v := New(Options{Secret: password, TTL: time.Hour})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	payload, err := v.UnsealMinTTL(cookie, 30*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+	_, err = v.UnsealMinTTL(cookie, 2*time.Hour)
+	assert.Equal(t, UnsealError{"Insufficient remaining lifetime"}, err)
+
+	// The cookie is near expiry from the point of view of a vault whose
+	// clock is 55 minutes ahead.
+	later := New(Options{Secret: password, LocalTimeOffset: 55 * time.Minute})
+	_, err = later.UnsealMinTTL(cookie, 10*time.Minute)
+	assert.Equal(t, UnsealError{"Insufficient remaining lifetime"}, err)
+	_, err = later.UnsealMinTTL(cookie, time.Minute)
+	assert.Nil(t, err)
+
+	forever, err := New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+	payload, err = v.UnsealMinTTL(forever, 24*time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+}
+
+func TestDistinguishesWrongSecretWithKCV(t *testing.T) {
+	v := New(Options{Secret: password, IncludeKCV: true})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	assert.Contains(t, cookie, "*kcv=")
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	// Vaults without IncludeKCV still check it, and Node Iron's cookies
+	// have none to check.
+	_, err = New(Options{Secret: rawKey}).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Wrong secret"}, err)
+	plain, err := New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+	_, err = New(Options{Secret: rawKey, IncludeKCV: true}).Unseal(plain)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	parts := strings.Split(cookie, delimiter)
+	parts[4] = parts[4][1:]
+	_, err = v.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	parts = strings.Split(cookie, delimiter)
+	parts[6] = "kcv=AAAA"
+	_, err = v.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Invalid key check value"}, err)
+
+	mte := New(Options{Secret: password, IncludeKCV: true, MACOrder: MACThenEncrypt})
+	cookie, err = mte.Seal(source)
+	assert.Nil(t, err)
+	_, err = New(Options{Secret: rawKey, MACOrder: MACThenEncrypt}).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Wrong secret"}, err)
+
+	assert.Equal(t, len(cookie), mte.SealedSize(len(source)))
+}
+
+func TestExportsIntegrityHasher(t *testing.T) {
+	v := New(Options{Secret: password})
+	expected, err := v.hmacWithPassword(salt, "streamed data")
+	assert.Nil(t, err)
+
+	h, err := v.IntegrityHasher(salt)
+	assert.Nil(t, err)
+	io.WriteString(h, "streamed ")
+	io.WriteString(h, "data")
+	assert.Equal(t, expected, h.Sum(nil))
+	assert.Equal(t, sha256.Size, h.Size())
+
+	other, err := v.IntegrityHasher([]byte("another salt"))
+	assert.Nil(t, err)
+	io.WriteString(other, "streamed data")
+	assert.NotEqual(t, expected, other.Sum(nil))
+
+	split := New(Options{Secret: password, IntegritySecret: rawKey})
+	h, err = split.IntegrityHasher(salt)
+	assert.Nil(t, err)
+	io.WriteString(h, "streamed data")
+	assert.NotEqual(t, expected, h.Sum(nil))
+}
+
+func TestExportsIntegrityHasherForCurrentSecret(t *testing.T) {
+	expected, err := New(Options{Secret: password}).hmacWithPassword(salt, "streamed data")
+	assert.Nil(t, err)
+
+	v := New(Options{Secrets: SecretMap{CurrentID: "a", Secrets: map[string][]byte{"a": password}}})
+	h, err := v.IntegrityHasher(salt)
+	assert.Nil(t, err)
+	io.WriteString(h, "streamed data")
+	assert.Equal(t, expected, h.Sum(nil))
+
+	_, err = New(Options{Secrets: SecretMap{CurrentID: "b"}}).IntegrityHasher(salt)
+	assert.Equal(t, UnsealError{"Unknown password id"}, err)
+}
+
+func TestDerivesKeysOfPinnedLength(t *testing.T) {
+	var keys [][]byte
+	truncating := CipherFactory(func(key, iv []byte) (cipher.BlockMode, cipher.BlockMode, error) {
+		keys = append(keys, append([]byte(nil), key...))
+		return AES256(key[:32], iv)
+	})
+	v, err := NewChecked(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 256, Iterations: 1, SaltBits: 32, Cipher: truncating,
+		DerivedKeyBytes: 48,
+	}})
+	assert.Nil(t, err)
+
+	keys = nil
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+	assert.Len(t, keys, 2)
+	assert.Len(t, keys[0], 48)
+
+	// The cipher's prefix is the key a vault deriving only 32 bytes uses.
+	payload, err = New(Options{Secret: password}).Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	// The built-in AES256 likewise uses the first 32 bytes.
+	builtIn, err := NewChecked(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 256, Iterations: 1, SaltBits: 32, Cipher: AES256,
+		DerivedKeyBytes: 48,
+	}})
+	assert.Nil(t, err)
+	payload, err = builtIn.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = NewChecked(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 256, Iterations: 1, SaltBits: 32, Cipher: AES256,
+		DerivedKeyBytes: 16,
+	}})
+	assert.Equal(t, ConfigError{"Encryption.DerivedKeyBytes 16 does not match the cipher's 256-bit key"}, err)
+	_, err = NewChecked(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 128, Iterations: 1, SaltBits: 32, Cipher: AES128,
+		DerivedKeyBytes: 32,
+	}})
+	assert.Equal(t, ConfigError{"Encryption.DerivedKeyBytes 32 does not match the cipher's 128-bit key"}, err)
+	_, err = NewChecked(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 256, Iterations: 1, SaltBits: 32, Cipher: truncating,
+		DerivedKeyBytes: -1,
+	}})
+	assert.Equal(t, ConfigError{"Encryption.DerivedKeyBytes may not be negative"}, err)
+}
+
+func TestDerivedBytesExtendGeneratedKey(t *testing.T) {
+	v := New(Options{Secret: password})
+	for _, keybits := range []uint{128, 256} {
+		key, err := v.generateKey(encryptionKey, keybits, 1, salt)
+		assert.Nil(t, err)
+		derived := v.deriveBytes(int(keybits/8)+12, 1, salt)
+		assert.Len(t, derived, int(keybits/8)+12)
+		assert.Equal(t, key, derived[:keybits/8])
+	}
+}
+
+func TestReturnsVerboseEncodingErrors(t *testing.T) {
+	ticket := "Fe26.2**b3ad22402ccc60fa4d527f7d1c9ff2e37e9b2e5723e9e2ffba39a489e9849609*QKCeXLs6Rp7f4LL56V7hBg*OvZEoAq_nGOpA1zae-fAtl7VNCNdhZhCqo-hWFCBeWuTTpSupJ7LxQqzSQBRAcgw**72018a21d3fac5c1608a0f9e461de0fcf17b2befe97855978c17a793faa01db1*Qj53DFE3GZd5yigt-mVl9lnp0VUoSjh5a5jgDmod1EZ"
+	v := New(Options{Secret: password, VerboseErrors: true})
+
+	parts := strings.Split(ticket, delimiter)
+	parts[3] = "QKCeXLs6R%7f4LL56V7hBg"
+	_, err := v.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Invalid component encoding: component 3 (iv): illegal base64 data at input byte 9"}, err)
+
+	_, err = New(Options{Secret: password}).Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Invalid component encoding"}, err)
+
+	parts = strings.Split(ticket, delimiter)
+	parts[4] = parts[4][:37] + "%" + parts[4][38:]
+	_, err = v.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Invalid component encoding: component 4 (body): illegal base64 data at input byte 37"}, err)
+}
+
+func TestReturnsVerboseEncodingErrorsAtCallerIndex(t *testing.T) {
+	for _, c := range []struct {
+		opts  Options
+		index int
+	}{
+		{Options{Secret: password, VerboseErrors: true, OmitPrefix: true}, 2},
+		{Options{Secret: password, VerboseErrors: true, FastReject: true}, 4},
+		{Options{Secret: password, VerboseErrors: true, OmitPrefix: true, FastReject: true}, 3},
+	} {
+		v := New(c.opts)
+		cookie, err := v.Seal(source)
+		assert.Nil(t, err)
+
+		// Corrupt the IV, re-tagging the cookie so it passes FastReject.
+		parts := strings.Split(cookie, delimiter)
+		parts[c.index] = parts[c.index][:9] + "%" + parts[c.index][10:]
+		if c.opts.FastReject {
+			parts[0] = v.fastTag(strings.Join(parts[1:], delimiter))
+		}
+		_, err = v.Unseal(strings.Join(parts, delimiter))
+		assert.Equal(t, UnsealError{fmt.Sprintf("Invalid component encoding: component %d (iv): illegal base64 data at input byte 9", c.index)}, err)
+	}
+}
+
+var rawKey = []byte(`0123456789abcdef0123456789abcdef`)
+
+func TestSealsWithRawKey(t *testing.T) {
+	v := New(Options{Secret: rawKey, RawKey: true})
+
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = New(Options{Secret: rawKey}).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestSplitsRawKey(t *testing.T) {
+	// A 256-bit secret yields a 128-bit encryption key as well as a
+	// 256-bit integrity key, each distinct from the secret and each other.
+	v := New(Options{Secret: rawKey, RawKey: true, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 128, Iterations: 1, SaltBits: 32, Cipher: AES128,
+	}})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	encKey, err := v.generateKey(encryptionKey, 128, 1, nil)
+	assert.Nil(t, err)
+	intKey, err := v.generateKey(integrityKey, 256, 1, nil)
+	assert.Nil(t, err)
+	assert.Len(t, encKey, 16)
+	assert.Len(t, intKey, 32)
+	assert.NotEqual(t, rawKey[:16], encKey)
+	assert.NotEqual(t, rawKey, intKey)
+	assert.NotEqual(t, encKey, intKey[:16])
+}
+
+func TestRejectsRawKeyOfWrongLength(t *testing.T) {
+	_, err := NewChecked(Options{Secret: password, RawKey: true})
+	assert.Equal(t, ErrRawKeyLength, err)
+	_, err = NewChecked(Options{Secret: rawKey, IntegritySecret: password, RawKey: true})
+	assert.Equal(t, ErrRawKeyLength, err)
+
+	v := New(Options{Secret: password, RawKey: true})
+	_, err = v.Seal(source)
+	assert.Equal(t, ErrRawKeyLength, err)
+	cookie, err := New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+	_, err = v.Unseal(cookie)
+	assert.Equal(t, ErrRawKeyLength, err)
+}
+
+func benchmarkSealAndUnseal(b *testing.B, opts Options) {
+	v := New(opts)
+	for i := 0; i < b.N; i++ {
+		cookie, err := v.Seal(source)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := v.Unseal(cookie); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestUnsealsAppending(t *testing.T) {
+	for _, opts := range []Options{
+		{Secret: password},
+		{Secret: password, Compression: CompressionAlways},
+		{Secret: password, MACOrder: MACThenEncrypt},
+		{Secret: password, Encryption: &Encryption{
+			IVBits: 16, KeyBits: 256, Iterations: 1, SaltBits: 32, Cipher: AES256,
+			LegacyTabPadding: true,
+		}},
+	} {
+		v := New(opts)
+		cookie, err := v.Seal(source)
+		assert.Nil(t, err)
+		expected, err := v.Unseal(cookie)
+		assert.Nil(t, err)
+
+		out, err := v.UnsealAppend(nil, cookie)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, out)
+
+		buf := make([]byte, 0, 256)
+		out, err = v.UnsealAppend(append(buf, "prefix:"...), cookie)
+		assert.Nil(t, err)
+		assert.Equal(t, "prefix:"+string(expected), string(out))
+		if opts.Compression == CompressionNone && opts.MACOrder == EncryptThenMAC {
+			assert.Equal(t, &buf[:1][0], &out[0])
+		}
+	}
+
+	v := New(Options{Secret: password})
+	cookie, err := v.SealFor("reset", source)
+	assert.Nil(t, err)
+	dst := []byte("prefix:")
+	out, err := v.UnsealAppend(dst, cookie)
+	assert.Equal(t, UnsealError{"Purpose mismatch"}, err)
+	assert.Equal(t, dst, out)
+	out, err = New(Options{Secret: rawKey}).UnsealAppend(dst, cookie)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+	assert.Equal(t, dst, out)
+}
+
+func benchmarkUnsealAppend(b *testing.B, reuse bool) {
+	v := New(Options{Secret: rawKey, RawKey: true})
+	cookie, err := v.Seal(bytes.Repeat([]byte{'x'}, 2048))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		if !reuse {
+			buf = nil
+		}
+		if buf, err = v.UnsealAppend(buf[:0], cookie); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnsealAppend(b *testing.B) {
+	benchmarkUnsealAppend(b, false)
+}
+
+func BenchmarkUnsealAppendReused(b *testing.B) {
+	benchmarkUnsealAppend(b, true)
+}
+
+func BenchmarkSealAndUnsealPBKDF2(b *testing.B) {
+	benchmarkSealAndUnseal(b, Options{Secret: rawKey, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 256, Iterations: 1000, SaltBits: 32, Cipher: AES256,
+	}, Integrity: &Integrity{
+		Hash: sha256.New, KeyBits: 256, Iterations: 1000, SaltBits: 32,
+	}})
+}
+
+func BenchmarkSealAndUnsealRawKey(b *testing.B) {
+	benchmarkSealAndUnseal(b, Options{Secret: rawKey, RawKey: true})
+}
+
+func TestSealsWithCustomSaltSource(t *testing.T) {
+	var counter uint64
+	v := New(Options{Secret: password, SaltSource: func(bits uint) ([]byte, error) {
+		counter++
+		salt := make([]byte, bits)
+		binary.BigEndian.PutUint64(salt[len(salt)-8:], counter)
+		return salt, nil
+	}})
+
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), counter)
+
+	parts := strings.Split(cookie, delimiter)
+	expected := make([]byte, 32)
+	expected[31] = 1
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(expected), parts[2])
+	expected[31] = 2
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(expected), parts[6])
+
+	payload, err := New(Options{Secret: password}).Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+}
+
+func TestRejectsSaltsOfWrongSize(t *testing.T) {
+	v := New(Options{Secret: password, SaltSource: func(bits uint) ([]byte, error) {
+		return make([]byte, bits-1), nil
+	}})
+
+	_, err := v.Seal(source)
+	assert.EqualError(t, err, "iron-go: salt source returned 31 bytes, expected 32")
+}
+
+func TestSealsForPurpose(t *testing.T) {
+	v := New(Options{Secret: password})
+	cookie, err := v.SealFor("password-reset", source)
+	assert.Nil(t, err)
+
+	payload, err := v.UnsealFor("password-reset", cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = v.UnsealFor("email-change", cookie)
+	assert.Equal(t, UnsealError{"Purpose mismatch"}, err)
+	_, err = v.Unseal(cookie)
+	assert.Equal(t, UnsealError{"Purpose mismatch"}, err)
+
+	plain, err := v.Seal(source)
+	assert.Nil(t, err)
+	_, err = v.UnsealFor("password-reset", plain)
+	assert.Equal(t, UnsealError{"Purpose mismatch"}, err)
+
+	resealed, err := v.Reseal(cookie)
+	assert.Nil(t, err)
+	_, err = v.UnsealFor("password-reset", resealed)
+	assert.Nil(t, err)
+}
+
+func TestPurposeIsAuthenticated(t *testing.T) {
+	v := New(Options{Secret: password})
+	cookie, err := v.SealFor("password-reset", source)
+	assert.Nil(t, err)
+
+	parts := strings.Split(cookie, delimiter)
+	assert.True(t, strings.HasPrefix(parts[6], "pur="))
+	parts[6] = "pur=" + base64.RawURLEncoding.EncodeToString([]byte("email-change"))
+	_, err = v.UnsealFor("email-change", strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestUsesConfiguredPBKDF2Hash(t *testing.T) {
+	sha1Vault := New(Options{Secret: password})
+	sha256Vault := New(Options{Secret: password, PBKDF2Hash: sha256.New})
+
+	assert.NotEqual(t, sha1Vault.deriveBytes(32, 1, salt), sha256Vault.deriveBytes(32, 1, salt))
+
+	cookie, err := sha256Vault.Seal(source)
+	assert.Nil(t, err)
+	payload, err := sha256Vault.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = sha1Vault.Unseal(cookie)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestExpiredErrorReportsOvershootAndSkew(t *testing.T) {
+	err := expiredError(3*time.Minute+12*time.Second+345678*time.Nanosecond, time.Minute)
+	assert.Equal(t, UnsealError{"Expired 3m12s ago (skew 1m0s)"}, err)
+	assert.True(t, errors.Is(err, ErrExpired))
+	assert.False(t, errors.Is(UnsealError{"Bad hmac value"}, ErrExpired))
+}
+
+func TestPadsBlockAlignedPayloads(t *testing.T) {
+	v := New(Options{Secret: password})
+
+	for _, size := range []int{15, 16, 17, 32} {
+		input := bytes.Repeat([]byte{'x'}, size)
+		cookie, err := v.Seal(input)
+		assert.Nil(t, err)
+
+		msg := &message{}
+		assert.Nil(t, msg.Unpack(cookie, &v.opts))
+		assert.Len(t, msg.EncryptedBody, (size/16+1)*16)
+
+		payload, err := v.Unseal(cookie)
+		assert.Nil(t, err)
+		assert.Equal(t, input, payload)
+	}
+}
+
+func TestPreservesTrailingPaddingLikeBytes(t *testing.T) {
+	v := New(Options{Secret: password})
+
+	for _, input := range [][]byte{[]byte("tabs\t\t"), {1}, bytes.Repeat([]byte{16}, 16)} {
+		cookie, err := v.Seal(input)
+		assert.Nil(t, err)
+		payload, err := v.Unseal(cookie)
+		assert.Nil(t, err)
+		assert.Equal(t, input, payload)
+	}
+}
+
+func TestSealsWithLegacyTabPadding(t *testing.T) {
+	legacy := New(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 256, Iterations: 1, SaltBits: 32, Cipher: AES256,
+		LegacyTabPadding: true,
+	}})
+
+	input := []byte("legacy cookie")
+	cookie, err := legacy.Seal(input)
+	assert.Nil(t, err)
+	payload, err := legacy.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, input, payload)
+
+	_, err = New(Options{Secret: password}).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Invalid padding"}, err)
+}
+
+func TestRejectsInvalidPadding(t *testing.T) {
+	for _, data := range [][]byte{
+		{},
+		append(bytes.Repeat([]byte{'x'}, 15), 0),
+		append(bytes.Repeat([]byte{'x'}, 15), 17),
+		append(bytes.Repeat([]byte{'x'}, 14), 1, 2),
+		bytes.Repeat([]byte{2}, 15),
+	} {
+		_, err := unpad(data, 16)
+		assert.Equal(t, UnsealError{"Invalid padding"}, err)
+	}
+
+	out, err := unpad(bytes.Repeat([]byte{16}, 16), 16)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{}, out)
+}
+
+// tripleDES is a cipher with 8-byte blocks, unlike AES's 16 bytes.
+func tripleDES(key, iv []byte) (cipher.BlockMode, cipher.BlockMode, error) {
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cipher.NewCBCEncrypter(block, iv), cipher.NewCBCDecrypter(block, iv), nil
+}
+
+func TestRejectsMismatchedBlockSize(t *testing.T) {
+	desVault := New(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 8, KeyBits: 192, Iterations: 1, SaltBits: 32, Cipher: tripleDES,
+	}})
+	aesVault := New(Options{Secret: password})
+
+	// The HMAC covers the IV and ciphertext, so it verifies under either
+	// cipher, and only the block size shows the cookie is from another.
+	cookie, err := aesVault.Seal(source)
+	assert.Nil(t, err)
+	_, err = desVault.Unseal(cookie)
+	assert.Equal(t, UnsealError{"IV length does not match cipher block size"}, err)
+
+	cookie, err = desVault.Seal(source)
+	assert.Nil(t, err)
+	payload, err := desVault.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+	_, err = aesVault.Unseal(cookie)
+	assert.Equal(t, UnsealError{"IV length does not match cipher block size"}, err)
+
+	msg := &message{IV: make([]byte, 16), EncryptedBody: make([]byte, 24)}
+	_, err = aesVault.decrypt(msg)
+	assert.Equal(t, UnsealError{"Ciphertext length is not a multiple of cipher block size"}, err)
+}
+
+func TestReportsPayloadSize(t *testing.T) {
+	v := New(Options{Secret: password})
+
+	for _, size := range []int{0, 1, 15, 16, 17, 100, 4096} {
+		cookie, err := v.Seal(bytes.Repeat([]byte{'x'}, size))
+		assert.Nil(t, err)
+
+		n, err := v.PayloadSize(cookie)
+		assert.Nil(t, err)
+		assert.Equal(t, size, n)
+	}
+
+	n, err := v.PayloadSize("Fe26.2**0cdd607945dd1dffb7da0b0bf5f1a7daa6218cbae14cac51dcbd91fb077aeb5b*aOZLCKLhCt0D5IU1qLTtYw*g0ilNDlQ3TsdFUqJCqAm9iL7Wa60H7eYcHL_5oP136TOJREkS3BzheDC1dlxz5oJ**05b8943049af490e913bbc3a2485bee2aaf7b823f4c41d0ff0b7c168371a3772*R8yscVdTBRMdsoVbdDiFmUL8zb-c3PQLGJn4Y8C-AqI")
+	assert.Nil(t, err)
+	assert.Equal(t, len(source), n)
+
+	_, err = v.PayloadSize("Fe26.2**b3ad22402ccc60fa4d527f7d1c9ff2e37e9b2e5723e9e2ffba39a489e9849609*QKCeXLs6Rp7f4LL56V7hBg*OvZEoAq_nGOpA1zae-fAtl7VNCNdhZhCqo-hWFCBeWuTTpSupJ7LxQqzSQBRAcgw**72018a21d3fac5c1608a0f9e461de0fcf17b2befe97855978c17a793faa01db1*Qj53DFE3GZd5yigt-mVl9lnp0VUoSjh5a5jgDmod1EZ")
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestDerivesIntegrityKeyIndependently(t *testing.T) {
+	integrity := func(iterations uint) *Integrity {
+		return &Integrity{Hash: sha256.New, KeyBits: 256, Iterations: iterations, SaltBits: 32}
+	}
+	encryption := func(iterations uint) *Encryption {
+		return &Encryption{IVBits: 16, KeyBits: 256, Iterations: iterations, SaltBits: 32, Cipher: AES256}
+	}
+
+	v := New(Options{Secret: password, Encryption: encryption(1), Integrity: integrity(1000)})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	// Changing only the integrity iterations invalidates the seal...
+	_, err = New(Options{Secret: password, Encryption: encryption(1), Integrity: integrity(1001)}).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	// ...while changing only the encryption iterations leaves it authentic,
+	// but undecryptable.
+	other := New(Options{Secret: password, Encryption: encryption(2), Integrity: integrity(1000)})
+	_, _, err = other.verify(cookie, nil)
+	assert.Nil(t, err)
+	payload, _ := other.Unseal(cookie)
+	assert.NotEqual(t, source, payload)
+
+	payload, err = v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+}
+
+func TestSealsWithHexHMAC(t *testing.T) {
+	v := New(Options{Secret: password, HMACEncoding: Hex})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	parts := strings.Split(cookie, delimiter)
+	assert.Regexp(t, "^[0-9a-f]{64}$", parts[7])
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = New(Options{Secret: password}).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Invalid component encoding"}, err)
+
+	cookie, err = New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+	_, err = v.Unseal(cookie)
+	assert.Equal(t, UnsealError{"Invalid component encoding"}, err)
+}
+
+func TestComparesPlaintexts(t *testing.T) {
+	v := New(Options{Secret: password})
+	a, err := v.Seal(source)
+	assert.Nil(t, err)
+	b, err := v.Seal(source)
+	assert.Nil(t, err)
+	assert.NotEqual(t, a, b)
+	c, err := v.Seal([]byte("other"))
+	assert.Nil(t, err)
+
+	same, err := v.SamePlaintext(a, b)
+	assert.Nil(t, err)
+	assert.True(t, same)
+
+	same, err = v.SamePlaintext(a, c)
+	assert.Nil(t, err)
+	assert.False(t, same)
+
+	_, err = v.SamePlaintext(a, b[1:])
+	assert.Equal(t, UnsealError{"Wrong mac prefix"}, err)
+}
+
+func TestVerifiesPlaintext(t *testing.T) {
+	v := New(Options{Secret: password})
+	sealed, err := v.Seal([]byte("hunter2"))
+	assert.Nil(t, err)
+
+	ok, err := v.VerifyPlaintext(sealed, []byte("hunter2"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = v.VerifyPlaintext(sealed, []byte("hunter3"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	ok, err = v.VerifyPlaintext(strings.Replace(sealed, "**", "*x*", 1), []byte("hunter2"))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+	assert.False(t, ok)
+}
+
+func TestEncryptsExpiration(t *testing.T) {
+	vault := New(Options{Secret: password, TTL: time.Minute, EncryptExpiration: true})
+	sealed, err := vault.Seal(source)
+	assert.Nil(t, err)
+	assert.Equal(t, "", strings.Split(sealed, delimiter)[5])
+
+	payload, err := vault.Unseal(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+	size, err := vault.PayloadSize(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, len(source), size)
+
+	resealed, err := vault.Reseal(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, "", strings.Split(resealed, delimiter)[5])
+
+	later := New(Options{Secret: password, EncryptExpiration: true, LocalTimeOffset: time.Hour})
+	_, err = later.Unseal(sealed)
+	assert.IsType(t, UnsealError{}, err)
+	_, err = later.Unseal(resealed)
+	assert.IsType(t, UnsealError{}, err)
+
+	forever, err := New(Options{Secret: password, EncryptExpiration: true}).Seal(source)
+	assert.Nil(t, err)
+	payload, err = later.Unseal(forever)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+}
+
+func TestReadsEncryptedExpirationFromCookie(t *testing.T) {
+	encrypting := New(Options{Secret: password, TTL: time.Minute, EncryptExpiration: true})
+	plain := New(Options{Secret: password, TTL: time.Minute})
+
+	sealed, err := encrypting.Seal(source)
+	assert.Nil(t, err)
+	assert.Contains(t, sealed, "*exp=encrypted*")
+	payload, err := plain.Unseal(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+	_, err = New(Options{Secret: password, LocalTimeOffset: time.Hour}).Unseal(sealed)
+	assert.IsType(t, UnsealError{}, err)
+
+	sealed, err = plain.Seal(source)
+	assert.Nil(t, err)
+	payload, err = encrypting.Unseal(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	// The flag is authenticated, and can't accompany a cleartext
+	// expiration.
+	sealed, err = New(Options{Secret: password, TTL: time.Minute, EmbedIssuedAt: true}).Seal(source)
+	assert.Nil(t, err)
+	_, err = plain.Unseal(strings.Replace(sealed, "*v=1*", "*exp=encrypted*v=1*", 1))
+	assert.Equal(t, UnsealError{"Invalid expiration time"}, err)
+	sealed, err = New(Options{Secret: password, EmbedIssuedAt: true}).Seal(source)
+	assert.Nil(t, err)
+	_, err = plain.Unseal(strings.Replace(sealed, "*v=1*", "*exp=encrypted*v=1*", 1))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestPadsToMultiple(t *testing.T) {
+	vault := New(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 256, Iterations: 1, SaltBits: 32, Cipher: AES256, PadToMultiple: 256,
+	}})
+
+	var lengths []int
+	for _, n := range []int{0, 1, 100, 252} {
+		payload := bytes.Repeat([]byte{'x'}, n)
+		sealed, err := vault.Seal(payload)
+		assert.Nil(t, err)
+		lengths = append(lengths, len(sealed))
+
+		unsealed, err := vault.Unseal(sealed)
+		assert.Nil(t, err)
+		assert.Equal(t, payload, unsealed)
+		size, err := vault.PayloadSize(sealed)
+		assert.Nil(t, err)
+		assert.Equal(t, n, size)
+	}
+	assert.Equal(t, []int{lengths[0], lengths[0], lengths[0], lengths[0]}, lengths)
+
+	sealed, err := vault.Seal(bytes.Repeat([]byte{'x'}, 253))
+	assert.Nil(t, err)
+	assert.True(t, len(sealed) > lengths[0])
+}
+
+func TestReadsPaddingFromCookie(t *testing.T) {
+	padded, err := New(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 256, Iterations: 1, SaltBits: 32, Cipher: AES256, PadToMultiple: 64,
+	}}).Seal(source)
+	assert.Nil(t, err)
+	assert.Contains(t, padded, "*pad=length*v=1*")
+
+	plain := New(Options{Secret: password})
+	payload, err := plain.Unseal(padded)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = plain.Unseal(strings.Replace(padded, "*pad=length*", "*", 1))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestSealsInEitherMACOrder(t *testing.T) {
+	encryptThenMAC := New(Options{Secret: password})
+	macThenEncrypt := New(Options{Secret: password, MACOrder: MACThenEncrypt})
+
+	for _, vault := range []*Vault{encryptThenMAC, macThenEncrypt} {
+		sealed, err := vault.Seal(source)
+		assert.Nil(t, err)
+		payload, err := vault.Unseal(sealed)
+		assert.Nil(t, err)
+		assert.Equal(t, source, payload)
+		size, err := vault.PayloadSize(sealed)
+		assert.Nil(t, err)
+		assert.Equal(t, len(source), size)
+	}
+
+	sealed, err := macThenEncrypt.Seal(source)
+	assert.Nil(t, err)
+	_, err = encryptThenMAC.Unseal(sealed)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	sealed, err = encryptThenMAC.Seal(source)
+	assert.Nil(t, err)
+	_, err = macThenEncrypt.Unseal(sealed)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	// The HMAC is encrypted after the payload, leaving the component empty.
+	sealed, err = macThenEncrypt.Seal(source)
+	assert.Nil(t, err)
+	parts := strings.Split(sealed, delimiter)
+	assert.Equal(t, "", parts[len(parts)-1])
+	body, err := base64.RawURLEncoding.DecodeString(parts[4])
+	assert.Nil(t, err)
+	assert.Equal(t, (len(source)+sha256.Size)/aes.BlockSize+1, len(body)/aes.BlockSize)
+	assert.Equal(t, len(sealed), macThenEncrypt.SealedSize(len(source)))
+
+	parts[len(parts)-1] = base64.RawURLEncoding.EncodeToString(make([]byte, sha256.Size))
+	_, err = macThenEncrypt.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	// Undecryptable bodies are reported as bad HMACs, not padding errors.
+	sealed, err = macThenEncrypt.Seal(source)
+	assert.Nil(t, err)
+	parts = strings.Split(sealed, delimiter)
+	parts[4] = parts[4][:len(parts[4])-4]
+	_, err = macThenEncrypt.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+// summingHash counts the digests computed with it.
+type summingHash struct {
+	hash.Hash
+	sums *int
+}
+
+func (c summingHash) Sum(b []byte) []byte {
+	*c.sums++
+	return c.Hash.Sum(b)
+}
+
+func TestMACThenEncryptComparesUndecryptableBodies(t *testing.T) {
+	var sums int
+	vault := New(Options{Secret: password, MACOrder: MACThenEncrypt, Integrity: &Integrity{
+		Hash:    func() hash.Hash { return summingHash{sha256.New(), &sums} },
+		KeyBits: 256, Iterations: 1, SaltBits: 32,
+	}})
+	sealed, err := vault.Seal(source)
+	assert.Nil(t, err)
+	parts := strings.Split(sealed, delimiter)
+
+	forged := append([]string(nil), parts...)
+	forged[len(forged)-2] = "forged"
+	sums = 0
+	_, err = vault.Unseal(strings.Join(forged, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+	forgedSums := sums
+
+	parts[4] = parts[4][:len(parts[4])-4]
+	sums = 0
+	_, err = vault.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+	assert.Equal(t, forgedSums, sums)
+}
+
+// failingReader is an io.Reader which always fails.
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("no entropy") }
+
+// flakyReader is an io.Reader which fails a number of times before reading
+// from crypto/rand.
+type flakyReader struct{ failures int }
+
+func (f *flakyReader) Read(p []byte) (int, error) {
+	if f.failures > 0 {
+		f.failures--
+		return 0, errors.New("transient failure")
+	}
+
+	return rand.Read(p)
+}
+
+func TestRetriesRandomSource(t *testing.T) {
+	v := New(Options{Secret: password, Rand: &flakyReader{failures: 1}, SealRetries: 2})
+	sealed, err := v.Seal(source)
+	assert.Nil(t, err)
+	payload, err := v.Unseal(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	flaky := &flakyReader{failures: 3}
+	_, err = New(Options{Secret: password, Rand: flaky, SealRetries: 2}).Seal(source)
+	assert.Equal(t, RandomError{errors.New("transient failure")}, err)
+	assert.Equal(t, 0, flaky.failures)
+
+	_, err = New(Options{Secret: password, Rand: &flakyReader{failures: 1}}).Seal(source)
+	assert.True(t, errors.Is(err, ErrRandomUnavailable))
+
+	_, err = NewChecked(Options{Secret: password, SealRetries: -1})
+	assert.Equal(t, ConfigError{"SealRetries may not be negative"}, err)
+	_, err = New(Options{Secret: password, Rand: &flakyReader{failures: 1}, SealRetries: -1}).Seal(source)
+	assert.Equal(t, RandomError{errors.New("transient failure")}, err)
+	assert.Equal(t, "Secure random source unavailable", RandomError{}.Error())
+}
+
+func TestGeneratesSecrets(t *testing.T) {
+	secret, err := GenerateSecret(48)
+	assert.Nil(t, err)
+	assert.Len(t, secret, 48)
+	other, err := GenerateSecret(48)
+	assert.Nil(t, err)
+	assert.NotEqual(t, secret, other)
+
+	_, err = GenerateSecret(31)
+	assert.Equal(t, ErrSecretTooShort, err)
+	_, err = generateSecret(&flakyReader{failures: 1}, 32)
+	assert.True(t, errors.Is(err, ErrRandomUnavailable))
+}
+
+func TestReportsUnavailableRandomSource(t *testing.T) {
+	broken := New(Options{Secret: password, Rand: failingReader{}})
+	_, err := broken.Seal(source)
+	assert.Equal(t, RandomError{errors.New("no entropy")}, err)
+	assert.True(t, errors.Is(err, ErrRandomUnavailable))
+	assert.Equal(t, "Secure random source unavailable: no entropy", err.Error())
+	assert.Equal(t, RandomError{errors.New("no entropy")}, broken.RandomHealthy())
+	assert.Nil(t, New(Options{Secret: password}).RandomHealthy())
+
+	fallback := New(Options{Secret: password, Rand: failingReader{}, RandFallbacks: []io.Reader{failingReader{}, rand.Reader}})
+	sealed, err := fallback.Seal(source)
+	assert.Nil(t, err)
+	payload, err := fallback.Unseal(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+	assert.NotNil(t, fallback.RandomHealthy())
 }
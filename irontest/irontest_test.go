@@ -0,0 +1,53 @@
+package irontest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/WatchBeam/iron-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	password = []byte(`some_not_random_password_that_is_also_long_enough`)
+	source   = []byte(`{"a":1,"b":2,"c":[3,4,5],"d":{"e":"f"}}`)
+)
+
+func TestFixedReaderRepeatsSeed(t *testing.T) {
+	r := &FixedReader{Seed: []byte{1, 2, 3}}
+	b := make([]byte, 7)
+	n, err := r.Read(b)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, n)
+	assert.Equal(t, []byte{1, 2, 3, 1, 2, 3, 1}, b)
+
+	n, err = (&FixedReader{}).Read(b)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, n)
+	assert.Equal(t, make([]byte, 7), b)
+}
+
+func TestDeterministicVaultsProduceIdenticalSeals(t *testing.T) {
+	seed := []byte("deterministic seed")
+	a, err := NewVault(password, seed).Seal(source)
+	assert.Nil(t, err)
+	b, err := NewVault(password, seed).Seal(source)
+	assert.Nil(t, err)
+	assert.Equal(t, a, b)
+
+	c, err := NewVault(password, []byte("another seed")).Seal(source)
+	assert.Nil(t, err)
+	assert.NotEqual(t, a, c)
+
+	payload, err := iron.New(iron.Options{Secret: password}).Unseal(a)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+}
+
+func ExampleNewVault() {
+	seed := []byte("deterministic seed")
+	a, _ := NewVault(password, seed).Seal(source)
+	b, _ := NewVault(password, seed).Seal(source)
+	fmt.Println(a == b)
+	// Output: true
+}
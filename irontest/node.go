@@ -0,0 +1,114 @@
+package irontest
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/WatchBeam/iron-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// nodeScript seals or unseals stdin with the Node Iron module, depending on
+// the IRON_MODE environment variable. Node Iron serializes payloads as JSON,
+// so sealed input must be valid JSON.
+const nodeScript = `
+const Iron = require(process.env.IRON_MODULE || '@hapi/iron');
+const chunks = [];
+process.stdin.on('data', (chunk) => chunks.push(chunk));
+process.stdin.on('end', async () => {
+	const input = Buffer.concat(chunks).toString();
+	const password = process.env.IRON_PASSWORD;
+	try {
+		if (process.env.IRON_MODE === 'seal') {
+			process.stdout.write(await Iron.seal(JSON.parse(input), password, Iron.defaults));
+		} else {
+			process.stdout.write(JSON.stringify(await Iron.unseal(input, password, Iron.defaults)));
+		}
+	} catch (err) {
+		process.stderr.write(err.message);
+		process.exit(1);
+	}
+});
+`
+
+// nodeCompatiblePayload is sealed in both directions by AssertNodeCompatible.
+// It must be JSON which Node re-serializes byte-for-byte.
+var nodeCompatiblePayload = []byte(`{"a":1,"b":2,"c":[3,4,5],"d":{"e":"f"}}`)
+
+// ErrNodeUnavailable is returned from NewNode when node or the Node Iron
+// module can't be found.
+var ErrNodeUnavailable = errors.New("irontest: node or the Node Iron module is unavailable")
+
+// Node seals and unseals cookies with a Node Iron implementation, for
+// example by wrapping a Node process or service.
+type Node struct {
+	Seal   func(payload []byte) (string, error)
+	Unseal func(sealed string) ([]byte, error)
+}
+
+// NewNode returns a Node which shells out to the node binary on the PATH,
+// using the Node Iron module (by default "@hapi/iron", or the module named
+// in the IRON_MODULE environment variable) with its default options. It
+// returns ErrNodeUnavailable if either can't be found.
+func NewNode(secret []byte) (*Node, error) {
+	bin, err := exec.LookPath("node")
+	if err != nil {
+		return nil, ErrNodeUnavailable
+	}
+
+	module := os.Getenv("IRON_MODULE")
+	if module == "" {
+		module = "@hapi/iron"
+	}
+	if err := exec.Command(bin, "-e", "require(process.argv[1])", module).Run(); err != nil {
+		return nil, ErrNodeUnavailable
+	}
+
+	run := func(mode string, input []byte) ([]byte, error) {
+		cmd := exec.Command(bin, "-e", nodeScript)
+		cmd.Env = append(os.Environ(), "IRON_MODE="+mode, "IRON_PASSWORD="+string(secret))
+		cmd.Stdin = bytes.NewReader(input)
+		stderr := bytes.NewBuffer(nil)
+		cmd.Stderr = stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, errors.New("irontest: node " + mode + " failed: " + stderr.String())
+		}
+
+		return out, nil
+	}
+
+	return &Node{
+		Seal: func(payload []byte) (string, error) {
+			out, err := run("seal", payload)
+			return string(out), err
+		},
+		Unseal: func(sealed string) ([]byte, error) {
+			return run("unseal", []byte(sealed))
+		},
+	}, nil
+}
+
+// AssertNodeCompatible asserts that cookies sealed by the vault can be
+// unsealed by Node, and that cookies sealed by Node can be unsealed by the
+// vault. The vault must be configured with the same secret as Node.
+func AssertNodeCompatible(t *testing.T, v *iron.Vault, node *Node) {
+	t.Helper()
+
+	sealed, err := v.Seal(nodeCompatiblePayload)
+	if assert.Nil(t, err) {
+		payload, err := node.Unseal(sealed)
+		assert.Nil(t, err, "node failed to unseal a cookie sealed by Go")
+		assert.Equal(t, string(nodeCompatiblePayload), string(payload))
+	}
+
+	sealed, err = node.Seal(nodeCompatiblePayload)
+	if assert.Nil(t, err) {
+		payload, err := v.Unseal(sealed)
+		assert.Nil(t, err, "Go failed to unseal a cookie sealed by node")
+		assert.Equal(t, string(nodeCompatiblePayload), string(payload))
+	}
+}
@@ -0,0 +1,19 @@
+package irontest
+
+import (
+	"testing"
+
+	"github.com/WatchBeam/iron-go"
+)
+
+func TestNodeCompatible(t *testing.T) {
+	node, err := NewNode(password)
+	if err == ErrNodeUnavailable {
+		t.Skip("node and the Node Iron module are required for this test")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	AssertNodeCompatible(t, iron.New(iron.Options{Secret: password}), node)
+}
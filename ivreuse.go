@@ -0,0 +1,62 @@
+package iron
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrIVReuse is returned from Seal when an IVReuseDetector sees a freshly
+// generated IV which it has seen recently. It indicates a failing random
+// source; the seal may be retried.
+var ErrIVReuse = errors.New("iron-go: IV reuse detected")
+
+// IVReuseDetector remembers recently generated IVs, so that a failing random
+// source repeating IVs is detected rather than leaking information about
+// payloads sealed under the same key. It's safe for concurrent use, and can
+// be shared between vaults.
+type IVReuseDetector struct {
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	order []string
+}
+
+// NewIVReuseDetector creates a detector which remembers up to size IVs, for
+// up to ttl each.
+func NewIVReuseDetector(size int, ttl time.Duration) *IVReuseDetector {
+	return &IVReuseDetector{size: size, ttl: ttl, seen: make(map[string]time.Time, size)}
+}
+
+// check records the IV, and reports whether it was already recorded.
+func (d *IVReuseDetector) check(iv []byte) bool {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Forget expired IVs, which were recorded in order.
+	for len(d.order) > 0 && now.Sub(d.seen[d.order[0]]) >= d.ttl {
+		delete(d.seen, d.order[0])
+		d.order = d.order[1:]
+	}
+
+	key := string(iv)
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+	if d.size <= 0 {
+		return false
+	}
+
+	// Forget the oldest IVs to make room for this one.
+	for len(d.order) >= d.size {
+		delete(d.seen, d.order[0])
+		d.order = d.order[1:]
+	}
+	d.seen[key] = now
+	d.order = append(d.order, key)
+
+	return false
+}
@@ -0,0 +1,64 @@
+package iron
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// repeatReader reads the same bytes forever.
+type repeatReader struct{}
+
+func (repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 7
+	}
+	return len(p), nil
+}
+
+func TestDetectsIVReuse(t *testing.T) {
+	v := New(Options{Secret: password, Rand: repeatReader{}, IVReuseDetector: NewIVReuseDetector(100, time.Hour)})
+	_, err := v.Seal(source)
+	assert.Nil(t, err)
+	_, err = v.Seal(source)
+	assert.Equal(t, ErrIVReuse, err)
+}
+
+func TestPassesRandomIVs(t *testing.T) {
+	v := New(Options{Secret: password, IVReuseDetector: NewIVReuseDetector(100, time.Hour)})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, err := v.Seal(source)
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestIVReuseDetectorIsBounded(t *testing.T) {
+	d := NewIVReuseDetector(2, time.Hour)
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+	assert.False(t, d.check(a))
+	assert.False(t, d.check(b))
+	assert.False(t, d.check(c))
+	assert.Len(t, d.seen, 2)
+
+	// a was forgotten to make room for c.
+	assert.False(t, d.check(a))
+	assert.True(t, d.check(c))
+
+	d = NewIVReuseDetector(2, time.Nanosecond)
+	assert.False(t, d.check(a))
+	time.Sleep(time.Millisecond)
+	assert.False(t, d.check(a))
+	assert.False(t, d.check(bytes.Repeat(a, 2)))
+}
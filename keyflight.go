@@ -0,0 +1,55 @@
+package iron
+
+import (
+	"strconv"
+	"sync"
+)
+
+// keyFlight deduplicates concurrent key derivations, so that a burst of
+// seals or unseals sharing a salt runs PBKDF2 once rather than once per
+// goroutine. Derivations are only shared while in flight; nothing is cached.
+type keyFlight struct {
+	mu    sync.Mutex
+	calls map[string]*keyCall
+}
+
+// keyCall is a derivation in flight.
+type keyCall struct {
+	done chan struct{}
+	dups int
+	key  []byte
+}
+
+// do returns the result of derive, sharing the result with any concurrent
+// calls with the same id. Callers must not modify the returned key.
+func (f *keyFlight) do(id string, derive func() []byte) []byte {
+	f.mu.Lock()
+	if c, ok := f.calls[id]; ok {
+		c.dups++
+		f.mu.Unlock()
+		<-c.done
+		return c.key
+	}
+	if f.calls == nil {
+		f.calls = make(map[string]*keyCall)
+	}
+	c := &keyCall{done: make(chan struct{})}
+	f.calls[id] = c
+	f.mu.Unlock()
+
+	c.key = derive()
+	f.mu.Lock()
+	delete(f.calls, id)
+	f.mu.Unlock()
+	close(c.done)
+
+	return c.key
+}
+
+// keyFlightID identifies a derivation. Lengths are included so that
+// secrets and salts containing the separator can't collide.
+func keyFlightID(secret, salt []byte, n int, iterations uint) string {
+	return strconv.Itoa(len(secret)) + ":" + string(secret) +
+		strconv.Itoa(len(salt)) + ":" + string(salt) +
+		strconv.Itoa(n) + ":" + strconv.FormatUint(uint64(iterations), 10)
+}
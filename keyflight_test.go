@@ -0,0 +1,95 @@
+package iron
+
+import (
+	"crypto/sha1"
+	"hash"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// countingHash returns a hash constructor which counts its calls, and
+// blocks the first of them until release is closed.
+func countingHash(calls *int32, release chan struct{}) func() hash.Hash {
+	return func() hash.Hash {
+		if atomic.AddInt32(calls, 1) == 1 && release != nil {
+			<-release
+		}
+		return sha1.New()
+	}
+}
+
+func TestDeduplicatesConcurrentDerivations(t *testing.T) {
+	var single int32
+	_, err := New(Options{Secret: password, PBKDF2Hash: countingHash(&single, nil)}).
+		generateKey(encryptionKey, 256, 1, salt)
+	assert.Nil(t, err)
+
+	var calls int32
+	release := make(chan struct{})
+	v := New(Options{Secret: password, PBKDF2Hash: countingHash(&calls, release)})
+
+	const n = 50
+	keys := make([][]byte, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keys[i], _ = v.generateKey(encryptionKey, 256, 1, salt)
+		}(i)
+	}
+
+	// Hold the first derivation until every other one has joined it.
+	id := keyFlightID(password, salt, 32, 1)
+	for {
+		v.keys.mu.Lock()
+		c := v.keys.calls[id]
+		joined := c != nil && c.dups == n-1
+		v.keys.mu.Unlock()
+		if joined {
+			break
+		}
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, single, atomic.LoadInt32(&calls))
+	for _, key := range keys {
+		assert.Equal(t, pbkdf2.Key(password, salt, 1, 32, sha1.New), key)
+	}
+	assert.Empty(t, v.keys.calls)
+}
+
+func TestDoesNotShareDerivationsAcrossSecrets(t *testing.T) {
+	v := New(Options{Secret: password})
+	other, err := v.withSecret(rawKey)
+	assert.Nil(t, err)
+
+	key, _ := v.generateKey(encryptionKey, 256, 1, salt)
+	otherKey, _ := other.generateKey(encryptionKey, 256, 1, salt)
+	assert.NotEqual(t, key, otherKey)
+	assert.Equal(t, pbkdf2.Key(rawKey, salt, 1, 32, sha1.New), otherKey)
+}
+
+func BenchmarkConcurrentDerivationShared(b *testing.B) {
+	v := New(Options{Secret: password})
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			v.deriveBytes(32, 10000, salt)
+		}
+	})
+}
+
+func BenchmarkConcurrentDerivationUnshared(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			pbkdf2.Key(password, salt, 10000, 32, sha1.New)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package iron
+
+import (
+	"context"
+	"net/http"
+)
+
+// sessionContextKey is the context key of the session payload.
+type sessionContextKey struct{}
+
+// SessionMiddleware loads the payload of a sealed session cookie into the
+// context of each request, where handlers can read it with
+// SessionFromContext, and saves new payloads with Save.
+type SessionMiddleware struct {
+	// Vault seals and unseals the session cookie.
+	Vault *Vault
+	// CookieName is the name of the session cookie.
+	CookieName string
+	// AAD, if set, derives additional data from each request, such as a
+	// digest of its User-Agent and the client's subnet, which its session
+	// cookie is bound to. A cookie is then only accepted from requests which
+	// give the same additional data as the one it was saved from, so a
+	// stolen cookie can't simply be replayed by another client.
+	AAD func(r *http.Request) []byte
+}
+
+// Handler returns a handler which loads the session into the request's
+// context before calling next. Requests without a valid session cookie are
+// passed on without a session.
+func (m *SessionMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie(m.CookieName); err == nil {
+			if payload, err := m.Vault.UnsealWithAAD(m.aad(r), cookie.Value); err == nil {
+				r = r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, payload))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Save seals the payload into the session cookie, bound to the request's
+// additional data, and sets it on the response.
+func (m *SessionMiddleware) Save(w http.ResponseWriter, r *http.Request, payload []byte) error {
+	sealed, err := m.Vault.SealWithAAD(m.aad(r), payload)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, m.Vault.cookie(m.CookieName, sealed))
+	return nil
+}
+
+// aad returns the additional data for the request, or nil if there's no
+// AAD function.
+func (m *SessionMiddleware) aad(r *http.Request) []byte {
+	if m.AAD == nil {
+		return nil
+	}
+
+	return m.AAD(r)
+}
+
+// SessionFromContext returns the session payload loaded by SessionMiddleware,
+// and whether there was one.
+func SessionFromContext(ctx context.Context) ([]byte, bool) {
+	payload, ok := ctx.Value(sessionContextKey{}).([]byte)
+	return payload, ok
+}
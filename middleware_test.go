@@ -0,0 +1,78 @@
+package iron
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func userAgentAAD(r *http.Request) []byte {
+	sum := sha256.Sum256([]byte(r.UserAgent()))
+	return sum[:]
+}
+
+// sessionRequest makes a request through the middleware with the cookie and
+// User-Agent, returning the session the handler saw.
+func sessionRequest(m *SessionMiddleware, cookie, userAgent string) ([]byte, bool) {
+	var payload []byte
+	var ok bool
+	h := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, ok = SessionFromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", cookie)
+	r.Header.Set("User-Agent", userAgent)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	return payload, ok
+}
+
+func TestSessionMiddlewareBindsToAAD(t *testing.T) {
+	m := &SessionMiddleware{Vault: New(Options{Secret: password}), CookieName: "session", AAD: userAgentAAD}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "original")
+	w := httptest.NewRecorder()
+	assert.Nil(t, m.Save(w, r, source))
+	cookie := w.Header().Get("Set-Cookie")
+	assert.Contains(t, cookie, "; HttpOnly")
+
+	payload, ok := sessionRequest(m, cookie, "original")
+	assert.True(t, ok)
+	assert.Equal(t, source, payload)
+
+	_, ok = sessionRequest(m, cookie, "different")
+	assert.False(t, ok)
+}
+
+func TestSessionMiddlewareWithoutAAD(t *testing.T) {
+	v := New(Options{Secret: password})
+	m := &SessionMiddleware{Vault: v, CookieName: "session"}
+	sealed, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	payload, ok := sessionRequest(m, "session="+sealed, "any")
+	assert.True(t, ok)
+	assert.Equal(t, source, payload)
+
+	_, ok = sessionRequest(m, "", "any")
+	assert.False(t, ok)
+}
+
+func TestUnsealsWithAAD(t *testing.T) {
+	v := New(Options{Secret: password})
+	sealed, err := v.SealWithAAD([]byte("client"), source)
+	assert.Nil(t, err)
+
+	payload, err := v.UnsealWithAAD([]byte("client"), sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = v.UnsealWithAAD([]byte("other"), sealed)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+	_, err = v.Unseal(sealed)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
@@ -0,0 +1,145 @@
+package iron
+
+import (
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// multiPrefix starts multi-recipient seals. They aren't Iron cookies, and
+// can't be unsealed with Unseal.
+var multiPrefix = "Fe26.2-multi"
+
+// multiKeySize is the size of a multi-recipient content key: an AES-256 key
+// followed by an HMAC-SHA256 key.
+const multiKeySize = 64
+
+// SealMulti seals the payload so that any one of the vaults can unseal it
+// with UnsealMulti. The payload is encrypted once under a random content
+// key, and each vault seals its own copy of that key, subject to its own
+// options and TTL. Since every recipient learns the content key, any of them
+// could also forge seals readable by the others.
+func SealMulti(b []byte, vaults []*Vault) (string, error) {
+	if len(vaults) == 0 {
+		return "", errors.New("iron-go: SealMulti needs at least one vault")
+	}
+
+	key, content, err := vaults[0].encryptContent(b)
+	if err != nil {
+		return "", err
+	}
+
+	parts := append([]string{multiPrefix}, content...)
+	for _, v := range vaults {
+		slot, err := v.sealKey(key)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, base64.RawURLEncoding.EncodeToString([]byte(slot)))
+	}
+
+	base := strings.Join(parts, delimiter)
+	return base + delimiter + base64.RawURLEncoding.EncodeToString(multiMAC(key, base)), nil
+}
+
+// UnsealMulti unseals a payload sealed by SealMulti, using the first
+// recipient slot the vault can unseal. It returns an UnsealError if the
+// seal is invalid or has no slot for the vault, or the slot's error
+// matching ErrExpired if its only slot has expired.
+func (v *Vault) UnsealMulti(sealed string) ([]byte, error) {
+	parts := strings.Split(sealed, delimiter)
+	if len(parts) < 5 {
+		return nil, UnsealError{"Incorrect number of sealed components"}
+	}
+	if parts[0] != multiPrefix {
+		return nil, UnsealError{"Wrong mac prefix"}
+	}
+
+	var key []byte
+	var slotErr error = UnsealError{"No recipient slot for this vault"}
+	for _, part := range parts[3 : len(parts)-1] {
+		var slot []byte
+		if err := base64decodeInto(&slot, part); err != nil {
+			return nil, UnsealError{"Invalid component encoding"}
+		}
+		k, err := v.Unseal(string(slot))
+		if err == nil && len(k) == multiKeySize {
+			key = k
+			break
+		}
+		if errors.Is(err, ErrExpired) {
+			slotErr = err
+		}
+	}
+	if key == nil {
+		return nil, slotErr
+	}
+
+	base := strings.Join(parts[:len(parts)-1], delimiter)
+	return decryptContent(key, parts[1], parts[2], base, parts[len(parts)-1])
+}
+
+// encryptContent encrypts the payload under a fresh random content key,
+// returning the key and the encoded IV and body components.
+func (v *Vault) encryptContent(b []byte) ([]byte, []string, error) {
+	key, err := v.randomBytes(multiKeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	iv, err := v.randomBytes(aes.BlockSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	encrypt, _, err := AES256(key[:32], iv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, []string{
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(encryptPadded(encrypt, b, false)),
+	}, nil
+}
+
+// decryptContent verifies the encoded MAC of the base under the content
+// key, and decrypts the encoded IV and body encrypted by encryptContent.
+func decryptContent(key []byte, encodedIV, encodedBody, base, encodedMAC string) ([]byte, error) {
+	var iv, body, mac []byte
+	for _, c := range []struct {
+		target *[]byte
+		src    string
+	}{
+		{&iv, encodedIV},
+		{&body, encodedBody},
+		{&mac, encodedMAC},
+	} {
+		if err := base64decodeInto(c.target, c.src); err != nil {
+			return nil, UnsealError{"Invalid component encoding"}
+		}
+	}
+
+	if !hmac.Equal(mac, multiMAC(key, base)) {
+		return nil, UnsealError{"Bad hmac value"}
+	}
+	if len(iv) != aes.BlockSize || len(body) == 0 || len(body)%aes.BlockSize != 0 {
+		return nil, UnsealError{"Invalid padding"}
+	}
+
+	_, decrypt, err := AES256(key[:32], iv)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, len(body))
+	decrypt.CryptBlocks(data, body)
+	return unpad(data, aes.BlockSize)
+}
+
+// multiMAC authenticates a multi-recipient seal's base with the content key.
+func multiMAC(key []byte, base string) []byte {
+	h := hmac.New(sha256.New, key[32:])
+	h.Write([]byte(base))
+	return h.Sum(nil)
+}
@@ -0,0 +1,67 @@
+package iron
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func multiVaults() []*Vault {
+	return []*Vault{
+		New(Options{Secret: []byte(strings.Repeat("a", 32))}),
+		New(Options{Secret: []byte(strings.Repeat("b", 32))}),
+		New(Options{Secret: []byte(strings.Repeat("c", 32))}),
+	}
+}
+
+func TestSealsForMultipleRecipients(t *testing.T) {
+	vaults := multiVaults()
+	sealed, err := SealMulti(source, vaults)
+	assert.Nil(t, err)
+
+	for _, v := range vaults {
+		payload, err := v.UnsealMulti(sealed)
+		assert.Nil(t, err)
+		assert.Equal(t, source, payload)
+	}
+
+	outsider := New(Options{Secret: []byte(strings.Repeat("d", 32))})
+	_, err = outsider.UnsealMulti(sealed)
+	assert.Equal(t, UnsealError{"No recipient slot for this vault"}, err)
+
+	_, err = vaults[0].Unseal(sealed)
+	assert.NotNil(t, err)
+}
+
+func TestMultiRecipientSealsAreAuthenticated(t *testing.T) {
+	vaults := multiVaults()
+	sealed, err := SealMulti(source, vaults)
+	assert.Nil(t, err)
+
+	parts := strings.Split(sealed, delimiter)
+	other, err := SealMulti([]byte("other"), vaults)
+	assert.Nil(t, err)
+	parts[2] = strings.Split(other, delimiter)[2]
+	_, err = vaults[1].UnsealMulti(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	_, err = vaults[1].UnsealMulti("Fe26.2*a*b*c*d")
+	assert.Equal(t, UnsealError{"Wrong mac prefix"}, err)
+}
+
+func TestMultiRecipientSlotsExpire(t *testing.T) {
+	sealed, err := SealMulti(source, []*Vault{New(Options{Secret: password, TTL: time.Hour})})
+	assert.Nil(t, err)
+
+	later := New(Options{Secret: password, LocalTimeOffset: 2 * time.Hour})
+	_, err = later.UnsealMulti(sealed)
+	assert.True(t, errors.Is(err, ErrExpired))
+}
+
+func TestSealMultiRequiresVaults(t *testing.T) {
+	_, err := SealMulti(source, nil)
+	assert.NotNil(t, err)
+}
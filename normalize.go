@@ -0,0 +1,34 @@
+package iron
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// CanonicalJSON is a normalizer for Options.Normalizer which rewrites a JSON
+// payload canonically, with object keys sorted and no insignificant
+// whitespace, so that equivalent JSON documents produce the same payload.
+// Numbers are kept as written. It returns an error if the payload isn't
+// valid JSON.
+func CanonicalJSON(b []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var value interface{}
+	if err := d.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, errors.New("iron-go: trailing data after JSON payload")
+	}
+
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(value); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,69 @@
+package iron
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizesCanonicalJSON(t *testing.T) {
+	a, err := CanonicalJSON([]byte(`{"b": [1, 2.50, {"y": "<", "x": null}], "a": true}`))
+	assert.Nil(t, err)
+	b, err := CanonicalJSON([]byte("{\n\t\"a\":true,\n\t\"b\":[1,2.50,{\"x\":null,\"y\":\"<\"}]\n}"))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":true,"b":[1,2.50,{"x":null,"y":"<"}]}`, string(a))
+	assert.Equal(t, a, b)
+
+	_, err = CanonicalJSON([]byte(`{"a":`))
+	assert.NotNil(t, err)
+	_, err = CanonicalJSON([]byte(`{} {}`))
+	assert.NotNil(t, err)
+}
+
+func TestSealsNormalizedPayloads(t *testing.T) {
+	seal := func(payload string) string {
+		v := New(Options{Secret: password, Normalizer: CanonicalJSON, Rand: bytes.NewReader(make([]byte, 128))})
+		cookie, err := v.Seal([]byte(payload))
+		assert.Nil(t, err)
+		return cookie
+	}
+
+	a := seal(`{"b": 2, "a": 1}`)
+	assert.Equal(t, a, seal(`{"a":1,"b":2}`))
+
+	payload, err := New(Options{Secret: password}).Unseal(a)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":1,"b":2}`, string(payload))
+
+	_, err = New(Options{Secret: password, Normalizer: CanonicalJSON}).Seal([]byte("not json"))
+	assert.NotNil(t, err)
+}
+
+func TestDoesNotNormalizeContentKeys(t *testing.T) {
+	v := New(Options{Secret: password, Normalizer: CanonicalJSON})
+
+	sealed, err := v.SealEnvelope(source)
+	assert.Nil(t, err)
+	payload, err := v.UnsealEnvelope(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	newKEK := New(Options{Secret: rawKey, Normalizer: CanonicalJSON})
+	sealed, err = v.RewrapEnvelope(sealed, newKEK)
+	assert.Nil(t, err)
+	payload, err = newKEK.UnsealEnvelope(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	sealed, err = SealMulti(source, []*Vault{v})
+	assert.Nil(t, err)
+	payload, err = v.UnsealMulti(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	var stream, unsealed bytes.Buffer
+	assert.Nil(t, v.SealStream(&stream, bytes.NewReader(source)))
+	assert.Nil(t, v.UnsealStream(&unsealed, &stream))
+	assert.Equal(t, source, unsealed.Bytes())
+}
@@ -0,0 +1,67 @@
+package iron
+
+import "time"
+
+// Opened is an unsealed cookie, with what's known about how it was sealed.
+type Opened struct {
+	// Payload is the unsealed payload.
+	Payload []byte
+	// ExpiresAt is the time the cookie expires, or zero if it doesn't.
+	ExpiresAt time.Time
+	// IssuedAt is the time the cookie was sealed, or zero if it was sealed
+	// without Options.EmbedIssuedAt.
+	IssuedAt time.Time
+	// PasswordID is the ID of the secret the cookie was sealed with, or
+	// empty if it was sealed with a single secret.
+	PasswordID string
+	// SecretIndex is 0 if the cookie was sealed with the vault's current
+	// secret, or its only one, and 1 if it was sealed with an older secret.
+	// SecretProviders don't order their older secrets, so they're not told
+	// apart.
+	SecretIndex int
+
+	// offset is the vault's LocalTimeOffset.
+	offset time.Duration
+}
+
+// RemainingTTL returns how long the cookie has until it expires, which
+// may be negative if it expired within the vault's TimestampSkew. It
+// returns zero if the cookie doesn't expire.
+func (o *Opened) RemainingTTL() time.Duration {
+	if o.ExpiresAt.IsZero() {
+		return 0
+	}
+
+	return o.ExpiresAt.Sub(time.Now().Add(o.offset))
+}
+
+// NeedsRotation reports whether the cookie was sealed with a secret other
+// than the one with the ID, typically the current secret, and so should be
+// resealed.
+func (o *Opened) NeedsRotation(defaultID string) bool {
+	return o.PasswordID != defaultID
+}
+
+// Open unseals the cookie like Unseal, returning the payload along with
+// its expiration, issued-at time and the secret it was sealed with.
+func (v *Vault) Open(sealed string) (*Opened, error) {
+	msg, payload, err := v.unsealFor("", nil, sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	opened := &Opened{
+		Payload:    payload,
+		ExpiresAt:  msg.Expiration,
+		IssuedAt:   msg.IssuedAt,
+		PasswordID: msg.PasswordID,
+		offset:     v.opts.LocalTimeOffset,
+	}
+	if v.opts.Secrets != nil {
+		if id, _, err := v.opts.Secrets.Current(); err != nil || id != msg.PasswordID {
+			opened.SecretIndex = 1
+		}
+	}
+
+	return opened, nil
+}
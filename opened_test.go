@@ -0,0 +1,43 @@
+package iron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpensCookies(t *testing.T) {
+	secrets := newRotatingSecrets()
+	v := New(Options{Secrets: secrets, TTL: time.Hour, EmbedIssuedAt: true})
+	before := time.Now()
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	opened, err := v.Open(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, opened.Payload)
+	assert.Equal(t, "one", opened.PasswordID)
+	assert.Equal(t, 0, opened.SecretIndex)
+	assert.WithinDuration(t, before, opened.IssuedAt, time.Second)
+	assert.WithinDuration(t, before.Add(time.Hour), opened.ExpiresAt, time.Second)
+	assert.InDelta(t, time.Hour, opened.RemainingTTL(), float64(time.Second))
+	assert.False(t, opened.NeedsRotation("one"))
+	assert.True(t, opened.NeedsRotation("two"))
+
+	secrets.rotate("two")
+	opened, err = v.Open(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, opened.SecretIndex)
+
+	plain := New(Options{Secret: password})
+	cookie, err = plain.Seal(source)
+	assert.Nil(t, err)
+	opened, err = plain.Open(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, &Opened{Payload: source}, opened)
+	assert.Equal(t, time.Duration(0), opened.RemainingTTL())
+
+	_, err = New(Options{Secret: rawKey}).Open(cookie)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
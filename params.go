@@ -0,0 +1,140 @@
+package iron
+
+import (
+	"strconv"
+	"strings"
+)
+
+// paramSep separates the fields of the parameters component.
+const paramSep = "."
+
+// MaxSealIterations is the most PBKDF2 iterations VaultFromSeal accepts from
+// a cookie's embedded parameters. The parameters are read before the cookie
+// is authenticated, so without a limit a forged cookie could make deriving
+// its keys arbitrarily slow.
+const MaxSealIterations = 1000000
+
+// parameters encodes the parameters needed to unseal a cookie, for the
+// component added by EmbedParameters: the cipher, encryption key bits and
+// iterations, integrity hash, key bits and iterations, and the PBKDF2 hash,
+// or "raw" for a raw key, followed by the derived key bytes if they're set.
+func (d VaultDescription) parameters() string {
+	kdf := d.PBKDF2Hash
+	if kdf == "" {
+		kdf = "raw"
+	}
+
+	fields := []string{
+		d.Cipher,
+		strconv.FormatUint(uint64(d.EncryptionKeyBits), 10),
+		strconv.FormatUint(uint64(d.EncryptionIterations), 10),
+		d.IntegrityHash,
+		strconv.FormatUint(uint64(d.IntegrityKeyBits), 10),
+		strconv.FormatUint(uint64(d.IntegrityIterations), 10),
+		kdf,
+	}
+	if d.DerivedKeyBytes > 0 {
+		fields = append(fields, strconv.Itoa(d.DerivedKeyBytes))
+	}
+
+	return strings.Join(fields, paramSep)
+}
+
+// parseParameters decodes a parameters component into the fields of a
+// description it covers. It returns an UnsealError if the component is
+// invalid.
+func parseParameters(s string) (VaultDescription, error) {
+	fields := strings.Split(s, paramSep)
+	if len(fields) != 7 && len(fields) != 8 {
+		return VaultDescription{}, UnsealError{"Invalid parameters"}
+	}
+
+	var nums [4]uint
+	for i, field := range []string{fields[1], fields[2], fields[4], fields[5]} {
+		n, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return VaultDescription{}, UnsealError{"Invalid parameters"}
+		}
+		nums[i] = uint(n)
+	}
+
+	d := VaultDescription{
+		Cipher:               fields[0],
+		EncryptionKeyBits:    nums[0],
+		EncryptionIterations: nums[1],
+		IntegrityHash:        fields[3],
+		IntegrityKeyBits:     nums[2],
+		IntegrityIterations:  nums[3],
+		PBKDF2Hash:           fields[6],
+	}
+	if d.PBKDF2Hash == "raw" {
+		d.PBKDF2Hash = ""
+	}
+	if len(fields) == 8 {
+		n, err := strconv.ParseUint(fields[7], 10, 16)
+		if err != nil || n == 0 {
+			return VaultDescription{}, UnsealError{"Invalid parameters"}
+		}
+		d.DerivedKeyBytes = int(n)
+	}
+
+	return d, nil
+}
+
+// VaultFromSeal creates a vault configured to unseal the cookie with the
+// secret, from the parameters embedded by EmbedParameters. It returns an
+// UnsealError if the cookie is invalid, has no embedded parameters, or they
+// call for more than MaxSealIterations iterations, and an error if they
+// name an unknown cipher or hash.
+func VaultFromSeal(sealed string, secret []byte) (*Vault, error) {
+	msg := &message{}
+	if err := msg.Unpack(sealed, &Options{}); err != nil {
+		return nil, err
+	}
+	if msg.Parameters == "" {
+		return nil, UnsealError{"Seal has no embedded parameters"}
+	}
+
+	d, err := parseParameters(msg.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	if d.EncryptionIterations > MaxSealIterations || d.IntegrityIterations > MaxSealIterations {
+		return nil, UnsealError{"Too many iterations"}
+	}
+	cipher, err := CipherByName(d.Cipher)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := HashByName(d.IntegrityHash)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := Options{
+		Secret:          secret,
+		RawKey:          d.PBKDF2Hash == "",
+		EmbedParameters: true,
+		Encryption: &Encryption{
+			IVBits:          16,
+			KeyBits:         d.EncryptionKeyBits,
+			Iterations:      d.EncryptionIterations,
+			SaltBits:        32,
+			Cipher:          cipher,
+			DerivedKeyBytes: d.DerivedKeyBytes,
+		},
+		Integrity: &Integrity{
+			Hash:       hash,
+			KeyBits:    d.IntegrityKeyBits,
+			Iterations: d.IntegrityIterations,
+			SaltBits:   32,
+		},
+	}
+	if !opts.RawKey {
+		if opts.PBKDF2Hash, err = HashByName(d.PBKDF2Hash); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewChecked(opts)
+}
@@ -0,0 +1,154 @@
+package iron
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbedsParameters(t *testing.T) {
+	v := New(Options{Secret: password, EmbedParameters: true})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	assert.Contains(t, cookie, "*par=aes-256-cbc.256.1.sha256.256.1.sha1*")
+
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+}
+
+func TestRejectsDowngradedParameters(t *testing.T) {
+	v := New(Options{Secret: password, EmbedParameters: true})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	downgraded := strings.Replace(cookie, "par=aes-256-cbc.256.", "par=aes-128-cbc.128.", 1)
+	assert.NotEqual(t, cookie, downgraded)
+	_, err = v.Unseal(downgraded)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	weak := New(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 128, Iterations: 1, SaltBits: 32, Cipher: AES128,
+	}})
+	_, err = weak.Unseal(downgraded)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestRejectsMismatchedParameters(t *testing.T) {
+	cookie, err := New(Options{Secret: password, EmbedParameters: true}).Seal(source)
+	assert.Nil(t, err)
+
+	// The HMAC still verifies, since the integrity parameters match, but
+	// the vault won't decrypt with parameters other than those sealed.
+	v := New(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 256, Iterations: 2, SaltBits: 32, Cipher: AES256,
+	}})
+	_, err = v.Unseal(cookie)
+	assert.Equal(t, UnsealError{"Sealed parameters do not match the vault"}, err)
+}
+
+func TestRejectsInvalidParameters(t *testing.T) {
+	for _, par := range []string{"aes-256-cbc", "aes-256-cbc.x.1.sha256.256.1.sha1", "aes-256-cbc.256.1.sha256.256.1.sha1.0"} {
+		_, err := ParseSeal("Fe26.2**salt*aOZLCKLhCt0D5IU1qLTtYw*g0ilNDlQ3TsdFUqJCqAm9iL7Wa60H7eYcHL_5oP136TOJREkS3BzheDC1dlxz5oJ**par=" + par + "*salt*" + base64.RawURLEncoding.EncodeToString(make([]byte, 32)))
+		assert.Equal(t, UnsealError{"Invalid parameters"}, err)
+	}
+}
+
+func TestCreatesVaultFromSeal(t *testing.T) {
+	cookie, err := New(Options{
+		Secret:          password,
+		EmbedParameters: true,
+		PBKDF2Hash:      sha256.New,
+		Encryption:      &Encryption{IVBits: 16, KeyBits: 128, Iterations: 3, SaltBits: 32, Cipher: AES128},
+		Integrity:       &Integrity{Hash: sha512.New, KeyBits: 512, Iterations: 5, SaltBits: 32},
+	}).Seal(source)
+	assert.Nil(t, err)
+
+	v, err := VaultFromSeal(cookie, password)
+	assert.Nil(t, err)
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	d := v.Describe()
+	assert.Equal(t, "aes-128-cbc", d.Cipher)
+	assert.Equal(t, "sha512", d.IntegrityHash)
+	assert.Equal(t, "sha256", d.PBKDF2Hash)
+}
+
+func TestEmbedsDerivedKeyBytes(t *testing.T) {
+	cookie, err := New(Options{Secret: password, EmbedParameters: true, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 256, Iterations: 1, SaltBits: 32, Cipher: AES256, DerivedKeyBytes: 32,
+	}}).Seal(source)
+	assert.Nil(t, err)
+	assert.Contains(t, cookie, "*par=aes-256-cbc.256.1.sha256.256.1.sha1.32*")
+
+	v, err := VaultFromSeal(cookie, password)
+	assert.Nil(t, err)
+	assert.Equal(t, 32, v.Describe().DerivedKeyBytes)
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = New(Options{Secret: password}).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Sealed parameters do not match the vault"}, err)
+}
+
+func TestCreatesVaultFromRawKeySeal(t *testing.T) {
+	cookie, err := New(Options{Secret: rawKey, RawKey: true, EmbedParameters: true}).Seal(source)
+	assert.Nil(t, err)
+
+	v, err := VaultFromSeal(cookie, rawKey)
+	assert.Nil(t, err)
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+}
+
+func TestVaultFromSealRequiresParameters(t *testing.T) {
+	cookie, err := New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+
+	_, err = VaultFromSeal(cookie, password)
+	assert.Equal(t, UnsealError{"Seal has no embedded parameters"}, err)
+}
+
+func TestVaultFromSealLimitsIterations(t *testing.T) {
+	cookie, err := New(Options{Secret: password, EmbedParameters: true}).Seal(source)
+	assert.Nil(t, err)
+
+	for _, par := range []string{"aes-256-cbc.256.1000001.sha256.256.1.sha1", "aes-256-cbc.256.1.sha256.256.4294967295.sha1"} {
+		forged := strings.Replace(cookie, "par=aes-256-cbc.256.1.sha256.256.1.sha1", "par="+par, 1)
+		_, err = VaultFromSeal(forged, password)
+		assert.Equal(t, UnsealError{"Too many iterations"}, err)
+	}
+
+	forged := strings.Replace(cookie, "par=aes-256-cbc.256.1.", "par=aes-256-cbc.256.1000000.", 1)
+	v, err := VaultFromSeal(forged, password)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(MaxSealIterations), v.Describe().EncryptionIterations)
+}
+
+func TestParsesEmbeddedParameters(t *testing.T) {
+	cookie, err := New(Options{Secret: password, EmbedParameters: true, Integrity: &Integrity{
+		KeyBits: 256, Iterations: 1, SaltBits: 256, Hash: sha512.New,
+	}}).Seal(source)
+	assert.Nil(t, err)
+	parsed, err := ParseSeal(cookie)
+	assert.Nil(t, err)
+	assert.True(t, parsed.ParametersEmbedded)
+	assert.Equal(t, "aes-256-cbc", parsed.Cipher)
+	assert.Equal(t, "sha512", parsed.Hash)
+
+	cookie, err = New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+	parsed, err = ParseSeal(cookie)
+	assert.Nil(t, err)
+	assert.False(t, parsed.ParametersEmbedded)
+	assert.Equal(t, "", parsed.Cipher)
+	assert.Equal(t, "", parsed.Hash)
+}
@@ -0,0 +1,132 @@
+package iron
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// ParsedSeal holds the cleartext components of a sealed cookie. None of them
+// have been authenticated, so they're suitable only for advisory decisions,
+// such as an edge dropping stale cookies before they reach the origin.
+type ParsedSeal struct {
+	// Prefix is the MAC prefix, such as "Fe26.2".
+	Prefix string
+	// PasswordID is the ID of the secret the seal claims to be sealed with,
+	// or empty if it was sealed with a single secret.
+	PasswordID string
+	// Expiration is the time after which the seal is invalid, or zero if
+	// the seal doesn't expire.
+	Expiration time.Time
+	// IssuedAt is the time the seal was created, or zero if it was sealed
+	// without Options.EmbedIssuedAt.
+	IssuedAt time.Time
+	// Header is the cleartext header given to SealWithHeader, or nil if the
+	// seal has none.
+	Header []byte
+	// Issuer is the issuer the seal claims to be sealed by, or empty if it
+	// was sealed without Options.Issuer.
+	Issuer string
+	// Audience is the audience the seal claims to be for, or empty if it
+	// was sealed without Options.Audience.
+	Audience string
+	// SaltLength and HMACSaltLength are the lengths of the encryption and
+	// integrity salt components.
+	SaltLength     int
+	HMACSaltLength int
+	// IV is the decoded IV.
+	IV []byte
+	// BodyLength is the length of the decoded ciphertext.
+	BodyLength int
+	// HMAC is the decoded HMAC.
+	HMAC []byte
+	// ParametersEmbedded reports whether the seal embeds the parameters it
+	// was sealed with, as with Options.EmbedParameters. If so, Cipher and
+	// Hash are the names of its cipher and integrity hash, as registered
+	// with CipherByName and HashByName, or "custom". Otherwise they're
+	// empty.
+	ParametersEmbedded bool
+	Cipher             string
+	Hash               string
+}
+
+// ParseSeal reads the cleartext components of a sealed cookie without
+// requiring the secret. It returns an UnsealError if the cookie is
+// malformed, but it does not verify the cookie's integrity; use Unseal for
+// that.
+func ParseSeal(sealed string) (*ParsedSeal, error) {
+	msg := &message{}
+	if err := msg.Unpack(sealed, &Options{}); err != nil {
+		return nil, err
+	}
+
+	parsed := &ParsedSeal{
+		Prefix:         msg.prefix,
+		SaltLength:     len(msg.Salt),
+		HMACSaltLength: len(msg.HMACSalt),
+		IV:             msg.IV,
+		BodyLength:     len(msg.EncryptedBody),
+		HMAC:           msg.HMAC,
+		PasswordID:     msg.PasswordID,
+		Expiration:     msg.Expiration,
+		IssuedAt:       msg.IssuedAt,
+		Header:         msg.Header,
+		Issuer:         msg.Issuer,
+		Audience:       msg.Audience,
+	}
+	if msg.Parameters != "" {
+		d, err := parseParameters(msg.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		parsed.ParametersEmbedded = true
+		parsed.Cipher, parsed.Hash = d.Cipher, d.IntegrityHash
+	}
+
+	return parsed, nil
+}
+
+// RefID returns a short, stable fingerprint of the sealed cookie, suitable
+// for correlating a cookie across log lines without logging the cookie
+// itself. It's the hex-encoded first 8 bytes of the SHA-256 of the whole
+// seal, and reveals nothing about the secret or payload.
+func RefID(sealed string) string {
+	sum := sha256.Sum256([]byte(sealed))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ETag returns a strong HTTP entity tag for the sealed cookie: the quoted,
+// hex-encoded first 16 bytes of the SHA-256 of the whole seal. It's stable
+// for the same seal, but sealing the same payload again gives a different
+// tag unless the salts and IVs are fixed, as by NewDeterministic.
+func ETag(sealed string) string {
+	sum := sha256.Sum256([]byte(sealed))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// EncodingOptions are the options which affect how a seal is encoded, but
+// not its keys or contents.
+type EncodingOptions struct {
+	OmitPrefix     bool
+	HMACEncoding   HMACEncoding
+	Base64Alphabet string
+}
+
+// options returns Options with the encoding options set.
+func (e EncodingOptions) options() *Options {
+	return &Options{OmitPrefix: e.OmitPrefix, HMACEncoding: e.HMACEncoding, Base64Alphabet: e.Base64Alphabet}
+}
+
+// Transcode re-encodes a seal made with the from encoding options into one
+// with the to options, without the secret. The decoded components are
+// unchanged, so the result unseals with a vault configured with the to
+// options. Seals with a fast-reject tag can't be transcoded. It returns an
+// UnsealError if the seal is invalid under the from options.
+func Transcode(sealed string, from, to EncodingOptions) (string, error) {
+	msg := &message{}
+	if err := msg.Unpack(sealed, from.options()); err != nil {
+		return "", err
+	}
+
+	return msg.Pack(to.options()), nil
+}
@@ -0,0 +1,439 @@
+package iron
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsesIssuedAtWithoutSecret(t *testing.T) {
+	v := New(Options{Secret: password, TTL: time.Hour, EmbedIssuedAt: true})
+
+	before := time.Now().Truncate(time.Millisecond)
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	parsed, err := ParseSeal(cookie)
+	assert.Nil(t, err)
+	assert.False(t, parsed.IssuedAt.Before(before))
+	assert.False(t, parsed.IssuedAt.After(time.Now()))
+	assert.Equal(t, time.Hour, parsed.Expiration.Sub(parsed.IssuedAt))
+
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+}
+
+func TestParsesSealWithoutIssuedAt(t *testing.T) {
+	parsed, err := ParseSeal("Fe26.2**0cdd607945dd1dffb7da0b0bf5f1a7daa6218cbae14cac51dcbd91fb077aeb5b*aOZLCKLhCt0D5IU1qLTtYw*g0ilNDlQ3TsdFUqJCqAm9iL7Wa60H7eYcHL_5oP136TOJREkS3BzheDC1dlxz5oJ**05b8943049af490e913bbc3a2485bee2aaf7b823f4c41d0ff0b7c168371a3772*R8yscVdTBRMdsoVbdDiFmUL8zb-c3PQLGJn4Y8C-AqI")
+	assert.Nil(t, err)
+	assert.True(t, parsed.IssuedAt.IsZero())
+	assert.True(t, parsed.Expiration.IsZero())
+	assert.Equal(t, "Fe26.2", parsed.Prefix)
+	assert.Equal(t, 64, parsed.SaltLength)
+	assert.Equal(t, 64, parsed.HMACSaltLength)
+	assert.Len(t, parsed.IV, 16)
+	assert.Equal(t, 48, parsed.BodyLength)
+	assert.Len(t, parsed.HMAC, 32)
+}
+
+func TestIssuedAtIsAuthenticated(t *testing.T) {
+	v := New(Options{Secret: password, EmbedIssuedAt: true})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	parts := strings.Split(cookie, delimiter)
+	assert.True(t, strings.HasPrefix(parts[6], "iat="))
+	parts[6] = "iat=1380495854060"
+	_, err = v.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	parts = append(parts[:6], parts[7:]...)
+	_, err = v.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestRejectsUnknownExtensions(t *testing.T) {
+	_, err := ParseSeal("Fe26.2**salt*aOZLCKLhCt0D5IU1qLTtYw*g0ilNDlQ3TsdFUqJCqAm9iL7Wa60H7eYcHL_5oP136TOJREkS3BzheDC1dlxz5oJ**foo=bar*salt*R8yscVdTBRMdsoVbdDiFmUL8zb-c3PQLGJn4Y8C-AqI")
+	assert.Equal(t, UnsealError{"Unknown sealed component"}, err)
+}
+
+func TestEmbedsFormatVersionWithExtensions(t *testing.T) {
+	cookie, err := New(Options{Secret: password, EmbedIssuedAt: true}).Seal(source)
+	assert.Nil(t, err)
+	assert.Contains(t, cookie, "*v=1*")
+
+	cookie, err = New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+	assert.NotContains(t, cookie, "v=")
+}
+
+func TestRejectsFutureFormatVersions(t *testing.T) {
+	_, err := ParseSeal("Fe26.2**salt*aOZLCKLhCt0D5IU1qLTtYw*g0ilNDlQ3TsdFUqJCqAm9iL7Wa60H7eYcHL_5oP136TOJREkS3BzheDC1dlxz5oJ**foo=bar*v=2*salt*R8yscVdTBRMdsoVbdDiFmUL8zb-c3PQLGJn4Y8C-AqI")
+	assert.Equal(t, UnsealError{"Unsupported iron-go format version 2"}, err)
+
+	// A correctly MACed seal from a future version is rejected for its
+	// version rather than failing the integrity check.
+	v := New(Options{Secret: password, EmbedIssuedAt: true})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	parts := strings.Split(cookie, delimiter)
+	parts[7] = "v=2"
+	parts = append(parts[:8], append([]string{"future=1"}, parts[8:]...)...)
+	base := strings.Join(parts[:9], delimiter)
+	digest, err := v.hmacWithPassword([]byte(parts[9]), base)
+	assert.Nil(t, err)
+	parts[10] = base64.RawURLEncoding.EncodeToString(digest)
+
+	_, err = v.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Unsupported iron-go format version 2"}, err)
+}
+
+func TestSealsWithHeader(t *testing.T) {
+	v := New(Options{Secret: password})
+	header := []byte(`{"kid":"abc","typ":"session"}`)
+
+	cookie, err := v.SealWithHeader(header, source)
+	assert.Nil(t, err)
+
+	parsed, err := ParseSeal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, header, parsed.Header)
+
+	h, payload, err := v.UnsealWithHeader(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, header, h)
+	assert.Equal(t, source, payload)
+
+	cookie, err = v.Seal(source)
+	assert.Nil(t, err)
+	h, _, err = v.UnsealWithHeader(cookie)
+	assert.Nil(t, err)
+	assert.Nil(t, h)
+}
+
+func TestHeaderIsAuthenticated(t *testing.T) {
+	v := New(Options{Secret: password})
+	cookie, err := v.SealWithHeader([]byte(`{"kid":"abc"}`), source)
+	assert.Nil(t, err)
+
+	parts := strings.Split(cookie, delimiter)
+	assert.True(t, strings.HasPrefix(parts[6], "hdr="))
+	parts[6] = "hdr=" + base64.RawURLEncoding.EncodeToString([]byte(`{"kid":"xyz"}`))
+	_, _, err = v.UnsealWithHeader(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestRefIDIsStableAndDistinct(t *testing.T) {
+	v := New(Options{Secret: password})
+	a, err := v.Seal(source)
+	assert.Nil(t, err)
+	b, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	assert.Regexp(t, `^[0-9a-f]{16}$`, RefID(a))
+	assert.Equal(t, RefID(a), RefID(a))
+	assert.NotEqual(t, RefID(a), RefID(b))
+	assert.NotContains(t, a, RefID(a))
+	assert.Equal(t, "e3b0c44298fc1c14", RefID(""))
+}
+
+func TestETagIsStableForSameSeal(t *testing.T) {
+	a, err := NewDeterministic(password, bytes.NewReader(make([]byte, 256))).Seal(source)
+	assert.Nil(t, err)
+	b, err := NewDeterministic(password, bytes.NewReader(make([]byte, 256))).Seal(source)
+	assert.Nil(t, err)
+	c, err := New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, ETag(a))
+	assert.Equal(t, ETag(a), ETag(b))
+	assert.NotEqual(t, ETag(a), ETag(c))
+}
+
+// malformedSeals are structurally odd seals, with empty or missing
+// components, which once risked slicing the MAC base out of range.
+var malformedSeals = []string{
+	"*******",
+	"Fe26.2*******",
+	"Fe26.2********",
+	"Fe26.2******=*",
+	"Fe26.2******a=b**",
+	"Fe26.2**a*b*c*d**",
+	"x*y",
+	"",
+}
+
+func TestRejectsMalformedSeals(t *testing.T) {
+	v := New(Options{Secret: password, AllowExtraComponents: true})
+	for _, sealed := range malformedSeals {
+		assert.NotPanics(t, func() {
+			_, err := v.Unseal(sealed)
+			assert.IsType(t, UnsealError{}, err, sealed)
+		})
+	}
+}
+
+func TestTranscodesSeals(t *testing.T) {
+	base64Vault := New(Options{Secret: password, EmbedIssuedAt: true})
+	hexVault := New(Options{Secret: password, HMACEncoding: Hex, OmitPrefix: true})
+	cookie, err := base64Vault.Seal(source)
+	assert.Nil(t, err)
+
+	hexOpts := EncodingOptions{HMACEncoding: Hex, OmitPrefix: true}
+	transcoded, err := Transcode(cookie, EncodingOptions{}, hexOpts)
+	assert.Nil(t, err)
+	assert.NotEqual(t, cookie, transcoded)
+	payload, err := hexVault.Unseal(transcoded)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	back, err := Transcode(transcoded, hexOpts, EncodingOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, cookie, back)
+
+	_, err = Transcode(cookie, EncodingOptions{HMACEncoding: Hex}, EncodingOptions{})
+	assert.Equal(t, UnsealError{"Invalid component encoding"}, err)
+}
+
+func TestVerifiesAudience(t *testing.T) {
+	v := New(Options{Secret: password, Audience: "eu", Issuer: "svc-a"})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	parsed, err := ParseSeal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, "eu", parsed.Audience)
+
+	eu := New(Options{Secret: password, AcceptedAudiences: []string{"eu"}})
+	payload, err := eu.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	us := New(Options{Secret: password, AcceptedAudiences: []string{"us"}})
+	_, err = us.Unseal(cookie)
+	assert.Equal(t, UnsealError{"Audience not accepted"}, err)
+
+	plain, err := New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+	_, err = eu.Unseal(plain)
+	assert.Equal(t, UnsealError{"Audience not accepted"}, err)
+
+	resealed, err := v.Reseal(cookie)
+	assert.Nil(t, err)
+	_, err = eu.Unseal(resealed)
+	assert.Nil(t, err)
+
+	// The audience is authenticated.
+	parts := strings.Split(cookie, delimiter)
+	assert.True(t, strings.HasPrefix(parts[7], "aud="))
+	parts[7] = "aud=" + base64.RawURLEncoding.EncodeToString([]byte("us"))
+	_, err = us.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestVerifiesIssuer(t *testing.T) {
+	cookie, err := New(Options{Secret: password, Issuer: "svc-a"}).Seal(source)
+	assert.Nil(t, err)
+
+	parsed, err := ParseSeal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, "svc-a", parsed.Issuer)
+
+	payload, err := New(Options{Secret: password, AcceptedIssuers: []string{"svc-b", "svc-a"}}).Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	trustsB := New(Options{Secret: password, AcceptedIssuers: []string{"svc-b"}})
+	_, err = trustsB.Unseal(cookie)
+	assert.Equal(t, UnsealError{"Untrusted issuer"}, err)
+
+	plain, err := New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+	_, err = trustsB.Unseal(plain)
+	assert.Equal(t, UnsealError{"Untrusted issuer"}, err)
+
+	// The issuer is authenticated.
+	parts := strings.Split(cookie, delimiter)
+	assert.True(t, strings.HasPrefix(parts[6], "iss="))
+	parts[6] = "iss=" + base64.RawURLEncoding.EncodeToString([]byte("svc-b"))
+	_, err = trustsB.Unseal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
+
+func TestResealsUnderOwnIssuer(t *testing.T) {
+	cookie, err := New(Options{Secret: password, Issuer: "svc-a"}).Seal(source)
+	assert.Nil(t, err)
+
+	for _, issuer := range []string{"svc-b", ""} {
+		resealed, err := New(Options{Secret: password, Issuer: issuer}).Reseal(cookie)
+		assert.Nil(t, err)
+		parsed, err := ParseSeal(resealed)
+		assert.Nil(t, err)
+		assert.Equal(t, issuer, parsed.Issuer)
+	}
+}
+
+func TestSealsWithCustomAlphabet(t *testing.T) {
+	alphabet := "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789.~"
+	vault := New(Options{Secret: password, Base64Alphabet: alphabet})
+	var cookie string
+	for !strings.ContainsAny(strings.TrimPrefix(cookie, macPrefix), ".~") {
+		var err error
+		cookie, err = vault.Seal(source)
+		assert.Nil(t, err)
+	}
+	assert.False(t, strings.ContainsAny(cookie, "-_"))
+
+	payload, err := vault.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = New(Options{Secret: password}).Unseal(cookie)
+	assert.NotNil(t, err)
+
+	standard, err := Transcode(cookie, EncodingOptions{Base64Alphabet: alphabet}, EncodingOptions{})
+	assert.Nil(t, err)
+	payload, err = New(Options{Secret: password}).Unseal(standard)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	for _, bad := range []string{"abc", strings.Repeat("A", 64), alphabet[:63] + "*", alphabet[:63] + "="} {
+		_, err := NewChecked(Options{Secret: password, Base64Alphabet: bad})
+		assert.IsType(t, ConfigError{}, err, bad)
+	}
+}
+
+func TestTranslatesExtensionsToCustomAlphabet(t *testing.T) {
+	alphabet := "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789.~"
+	opts := Options{Secret: password, Base64Alphabet: alphabet, Issuer: "\xfb\xff", IncludeKCV: true}
+	cookie, err := New(opts).Seal(source)
+	assert.Nil(t, err)
+	assert.False(t, strings.ContainsAny(cookie, "-_"))
+	assert.Contains(t, cookie, "*iss=.~8*")
+
+	payload, err := New(opts).Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	standard, err := Transcode(cookie, EncodingOptions{Base64Alphabet: alphabet}, EncodingOptions{})
+	assert.Nil(t, err)
+	assert.Contains(t, standard, "*iss=-_8*")
+	opts.Base64Alphabet = ""
+	_, err = New(opts).Unseal(standard)
+	assert.Nil(t, err)
+
+	opts.Base64Alphabet = alphabet
+	_, err = New(opts).Unseal(standard)
+	assert.Equal(t, UnsealError{"Invalid component encoding"}, err)
+}
+
+func TestAcceptsListedMACVersions(t *testing.T) {
+	current, err := New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+	legacy, err := New(Options{Secret: password, MACFormatVersion: "1"}).Seal(source)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(legacy, "Fe26.1*"))
+
+	both := New(Options{Secret: password, AcceptedMACVersions: []string{"1", "2"}})
+	for _, cookie := range []string{current, legacy} {
+		payload, err := both.Unseal(cookie)
+		assert.Nil(t, err)
+		assert.Equal(t, source, payload)
+	}
+
+	// The version is authenticated, so can't be rewritten.
+	_, err = both.Unseal("Fe26.1" + strings.TrimPrefix(current, macPrefix))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	_, err = New(Options{Secret: password}).Unseal(legacy)
+	assert.Equal(t, UnsealError{"Wrong mac prefix"}, err)
+	_, err = New(Options{Secret: password, AcceptedMACVersions: []string{"1"}}).Unseal(current)
+	assert.Equal(t, UnsealError{"Wrong mac prefix"}, err)
+
+	stripped := New(Options{Secret: password, MACFormatVersion: "1", OmitPrefix: true})
+	cookie, err := stripped.Seal(source)
+	assert.Nil(t, err)
+	payload, err := stripped.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = NewChecked(Options{Secret: password, MACFormatVersion: "2*"})
+	assert.Equal(t, ConfigError{"MACFormatVersion may not contain separators"}, err)
+}
+
+func TestPacksExpirationInResolution(t *testing.T) {
+	millis := New(Options{Secret: password, TTL: time.Hour})
+	seconds := New(Options{Secret: password, TTL: time.Hour, ExpirationResolution: Seconds})
+
+	for _, v := range []*Vault{millis, seconds} {
+		cookie, err := v.Seal(source)
+		assert.Nil(t, err)
+		payload, err := v.Unseal(cookie)
+		assert.Nil(t, err)
+		assert.Equal(t, source, payload)
+	}
+
+	now := time.Now()
+	cookie, err := seconds.Seal(source)
+	assert.Nil(t, err)
+	exp, err := strconv.ParseInt(strings.Split(cookie, delimiter)[5], 10, 64)
+	assert.Nil(t, err)
+	assert.InDelta(t, now.Add(time.Hour).Unix(), exp, 1)
+
+	_, err = millis.Unseal(cookie)
+	assert.IsType(t, UnsealError{}, err)
+
+	cookie, err = millis.Seal(source)
+	assert.Nil(t, err)
+	_, err = seconds.Unseal(cookie)
+	assert.Equal(t, UnsealError{"Invalid expiration time"}, err)
+}
+
+func TestSealsDelimitersInCleartextComponents(t *testing.T) {
+	hostile := "a*b\nc=d*"
+	v := New(Options{Secret: password, Issuer: hostile, Audience: hostile})
+	plain, err := New(Options{Secret: password}).Seal(source)
+	assert.Nil(t, err)
+
+	cookie, err := v.SealFor(hostile, source)
+	assert.Nil(t, err)
+	assert.NotContains(t, cookie, "\n")
+	// The issuer, audience and purpose add one component each, along with
+	// the version, however many delimiters they contain.
+	assert.Equal(t, strings.Count(plain, delimiter)+4, strings.Count(cookie, delimiter))
+
+	parsed, err := ParseSeal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, hostile, parsed.Issuer)
+	assert.Equal(t, hostile, parsed.Audience)
+
+	reader := New(Options{Secret: password, AcceptedIssuers: []string{hostile}, AcceptedAudiences: []string{hostile}})
+	payload, err := reader.UnsealFor(hostile, cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+	_, err = reader.UnsealFor("a", cookie)
+	assert.Equal(t, UnsealError{"Purpose mismatch"}, err)
+
+	cookie, err = v.SealWithHeader([]byte(hostile), source)
+	assert.Nil(t, err)
+	header, payload, err := reader.UnsealWithHeader(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, hostile, string(header))
+	assert.Equal(t, source, payload)
+
+	// Line breaks in encoded values are rejected.
+	parts := strings.Split(cookie, delimiter)
+	for i, part := range parts {
+		if strings.HasPrefix(part, "iss=") {
+			parts[i] = "iss=Y\nQ" // "a", with a line break
+		}
+	}
+	_, err = ParseSeal(strings.Join(parts, delimiter))
+	assert.Equal(t, UnsealError{"Invalid component encoding"}, err)
+}
@@ -0,0 +1,41 @@
+//go:build protobuf
+
+package iron
+
+import "google.golang.org/protobuf/proto"
+
+// protoTypeURLPrefix is the prefix of the type URLs which SealProto puts in
+// the header, as used by google.protobuf.Any.
+const protoTypeURLPrefix = "type.googleapis.com/"
+
+// SealProto marshals the protobuf message and seals it like SealWithHeader,
+// with the message's type URL as the header, so that UnsealProto can check
+// the cookie holds the expected type. It's only built with the "protobuf"
+// build tag, so that the protobuf module isn't a dependency otherwise.
+func (v *Vault) SealProto(m proto.Message) (string, error) {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	return v.SealWithHeader([]byte(protoTypeURL(m)), b)
+}
+
+// UnsealProto unseals a cookie sealed by SealProto into the message. It
+// returns an UnsealError if the cookie holds another type of message.
+func (v *Vault) UnsealProto(sealed string, m proto.Message) error {
+	header, payload, err := v.UnsealWithHeader(sealed)
+	if err != nil {
+		return err
+	}
+	if string(header) != protoTypeURL(m) {
+		return UnsealError{"Proto message type mismatch"}
+	}
+
+	return proto.Unmarshal(payload, m)
+}
+
+// protoTypeURL returns the type URL of the message's type.
+func protoTypeURL(m proto.Message) string {
+	return protoTypeURLPrefix + string(m.ProtoReflect().Descriptor().FullName())
+}
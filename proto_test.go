@@ -0,0 +1,33 @@
+//go:build protobuf
+
+package iron
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestSealsProto(t *testing.T) {
+	v := New(Options{Secret: password})
+	sealed, err := v.SealProto(wrapperspb.String("hello"))
+	assert.Nil(t, err)
+	header, _, err := v.UnsealWithHeader(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, "type.googleapis.com/google.protobuf.StringValue", string(header))
+
+	out := &wrapperspb.StringValue{}
+	assert.Nil(t, v.UnsealProto(sealed, out))
+	assert.True(t, proto.Equal(wrapperspb.String("hello"), out))
+
+	err = v.UnsealProto(sealed, &durationpb.Duration{})
+	assert.Equal(t, UnsealError{"Proto message type mismatch"}, err)
+
+	plain, err := v.Seal(source)
+	assert.Nil(t, err)
+	err = v.UnsealProto(plain, out)
+	assert.Equal(t, UnsealError{"Proto message type mismatch"}, err)
+}
@@ -0,0 +1,84 @@
+package iron
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Query parameter names used by SealQuery and UnsealQuery. The constant MAC
+// prefix isn't included in the query.
+const (
+	queryFastTag    = "f"
+	queryPasswordID = "id"
+	querySalt       = "s"
+	queryIV         = "iv"
+	queryBody       = "c"
+	queryExpiration = "t"
+	queryExtension  = "x"
+	queryHMACSalt   = "hs"
+	queryHMAC       = "m"
+)
+
+// SealQuery seals the payload like Seal, but returns its components as
+// separate query parameters, suitable for signed URLs. Each parameter is
+// URL-safe on its own.
+func (v *Vault) SealQuery(b []byte) (url.Values, error) {
+	sealed, err := v.Seal(b)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(sealed, delimiter)
+	values := url.Values{}
+	if v.opts.FastReject {
+		values.Set(queryFastTag, parts[0])
+		parts = parts[1:]
+	}
+	if !v.opts.OmitPrefix {
+		parts = parts[1:]
+	}
+
+	n := len(parts)
+	values.Set(queryPasswordID, parts[0])
+	values.Set(querySalt, parts[1])
+	values.Set(queryIV, parts[2])
+	values.Set(queryBody, parts[3])
+	values.Set(queryExpiration, parts[4])
+	for _, ext := range parts[5 : n-2] {
+		values.Add(queryExtension, ext)
+	}
+	values.Set(queryHMACSalt, parts[n-2])
+	values.Set(queryHMAC, parts[n-1])
+	return values, nil
+}
+
+// UnsealQuery reassembles a cookie from query parameters produced by
+// SealQuery and unseals it. It returns an UnsealError if the parameters are
+// invalid.
+func (v *Vault) UnsealQuery(values url.Values) ([]byte, error) {
+	var parts []string
+	if v.opts.FastReject {
+		parts = append(parts, values.Get(queryFastTag))
+	}
+	if !v.opts.OmitPrefix {
+		parts = append(parts, v.opts.sealPrefix())
+	}
+
+	parts = append(parts,
+		values.Get(queryPasswordID),
+		values.Get(querySalt),
+		values.Get(queryIV),
+		values.Get(queryBody),
+		values.Get(queryExpiration),
+	)
+	parts = append(parts, values[queryExtension]...)
+	parts = append(parts, values.Get(queryHMACSalt), values.Get(queryHMAC))
+
+	for _, part := range parts {
+		if strings.Contains(part, delimiter) {
+			return nil, UnsealError{"Invalid component encoding"}
+		}
+	}
+
+	return v.Unseal(strings.Join(parts, delimiter))
+}
@@ -0,0 +1,41 @@
+package iron
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealsToQuery(t *testing.T) {
+	for _, opts := range []Options{
+		{Secret: password},
+		{Secret: password, TTL: time.Hour, EmbedIssuedAt: true},
+		{Secret: password, OmitPrefix: true, FastReject: true},
+	} {
+		v := New(opts)
+		values, err := v.SealQuery(source)
+		assert.Nil(t, err)
+
+		parsed, err := url.ParseQuery(values.Encode())
+		assert.Nil(t, err)
+		payload, err := v.UnsealQuery(parsed)
+		assert.Nil(t, err)
+		assert.Equal(t, source, payload)
+	}
+}
+
+func TestRejectsTamperedQuery(t *testing.T) {
+	v := New(Options{Secret: password, TTL: time.Hour})
+	values, err := v.SealQuery(source)
+	assert.Nil(t, err)
+
+	values.Set(queryExpiration, "99999999999999")
+	_, err = v.UnsealQuery(values)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	values.Set(queryExpiration, "1*2")
+	_, err = v.UnsealQuery(values)
+	assert.Equal(t, UnsealError{"Invalid component encoding"}, err)
+}
@@ -0,0 +1,97 @@
+package iron
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"time"
+)
+
+// randomRetryBackoff is the delay before the first retry of a failed random
+// read, doubling for each further retry up to maxRandomRetryBackoff.
+const (
+	randomRetryBackoff    = time.Millisecond
+	maxRandomRetryBackoff = 100 * time.Millisecond
+)
+
+// ErrRandomUnavailable matches, via errors.Is, the RandomError returned when
+// no random source could supply salts or IVs.
+var ErrRandomUnavailable = errors.New("iron-go: secure random source unavailable")
+
+// RandomError is returned from Seal when Options.Rand and all of its
+// fallbacks fail, so that entropy problems can be told apart from other
+// sealing errors.
+type RandomError struct {
+	// Err is the error from the last source tried.
+	Err error
+}
+
+// Error implements error.Error
+func (r RandomError) Error() string {
+	if r.Err == nil {
+		return "Secure random source unavailable"
+	}
+	return "Secure random source unavailable: " + r.Err.Error()
+}
+
+// Is reports whether the target is ErrRandomUnavailable.
+func (r RandomError) Is(target error) bool { return target == ErrRandomUnavailable }
+
+// Unwrap returns the error from the last source tried.
+func (r RandomError) Unwrap() error { return r.Err }
+
+// GenerateSecret returns a new secret of n bytes from crypto/rand. It
+// returns ErrSecretTooShort if n is less than 32, and a RandomError if
+// crypto/rand fails.
+func GenerateSecret(n int) ([]byte, error) {
+	return generateSecret(rand.Reader, n)
+}
+
+// generateSecret returns a new secret of n bytes from the reader.
+func generateSecret(r io.Reader, n int) ([]byte, error) {
+	if n < 32 {
+		return nil, ErrSecretTooShort
+	}
+	b, err := randBits(r, uint(n))
+	if err != nil {
+		return nil, RandomError{err}
+	}
+
+	return b, nil
+}
+
+// randomBytes reads n random bytes from Options.Rand, trying each of
+// Options.RandFallbacks in turn if it fails. If they all fail, it retries
+// up to Options.SealRetries times, backing off between attempts, before
+// returning a RandomError. Negative SealRetries are treated as zero.
+func (v *Vault) randomBytes(n uint) ([]byte, error) {
+	var err error
+	backoff := randomRetryBackoff
+	for attempt := 0; attempt == 0 || attempt <= v.opts.SealRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > maxRandomRetryBackoff {
+				backoff = maxRandomRetryBackoff
+			}
+		}
+		for _, r := range append([]io.Reader{v.opts.Rand}, v.opts.RandFallbacks...) {
+			var b []byte
+			if b, err = randBits(r, n); err == nil {
+				return b, nil
+			}
+		}
+	}
+
+	return nil, RandomError{err}
+}
+
+// RandomHealthy probes Options.Rand, returning a RandomError if it fails. It
+// ignores RandFallbacks, so that a failing source is reported even while a
+// fallback covers for it.
+func (v *Vault) RandomHealthy() error {
+	if _, err := randBits(v.opts.Rand, 32); err != nil {
+		return RandomError{err}
+	}
+
+	return nil
+}
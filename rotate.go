@@ -0,0 +1,89 @@
+package iron
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// maxStoreLine is the longest line RotateStore will read.
+const maxStoreLine = 1 << 20
+
+// RotateFailure describes a line which RotateStore could not reseal.
+type RotateFailure struct {
+	// Line is the 1-indexed line number in the source.
+	Line int
+	// Err is the reason the line could not be resealed.
+	Err error
+}
+
+// RotateSummary reports the outcome of RotateStore.
+type RotateSummary struct {
+	// Resealed is the number of cookies written to the destination.
+	Resealed int
+	// Failed lists the lines which were skipped because they could not be
+	// resealed.
+	Failed []RotateFailure
+}
+
+// RotateStore reads newline-delimited sealed cookies from src, reseals each
+// one with Reseal, and writes them to dst one per line. Blank lines are
+// ignored. Cookies which fail to reseal are skipped and reported in the
+// summary rather than aborting the rotation. The returned error is non-nil
+// only if reading from src or writing to dst fails.
+func (v *Vault) RotateStore(src io.Reader, dst io.Writer) (RotateSummary, error) {
+	var summary RotateSummary
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(nil, maxStoreLine)
+
+	for line := 1; scanner.Scan(); line++ {
+		sealed := strings.TrimSpace(scanner.Text())
+		if sealed == "" {
+			continue
+		}
+
+		resealed, err := v.Reseal(sealed)
+		if err != nil {
+			summary.Failed = append(summary.Failed, RotateFailure{line, err})
+			continue
+		}
+
+		if _, err := io.WriteString(dst, resealed+"\n"); err != nil {
+			return summary, err
+		}
+		summary.Resealed++
+	}
+
+	return summary, scanner.Err()
+}
+
+// UnsealScan reads newline-delimited sealed cookies from r, unseals each one,
+// and passes the result to fn, stopping early if fn returns false. Blank
+// lines are ignored. Lines are read into a single reused buffer, and
+// payloads are unsealed into another where possible, so memory use stays
+// constant however large r is. The payload is only valid until fn
+// returns, so fn must copy it to retain it. The returned error is non-nil
+// only if reading from r fails.
+func (v *Vault) UnsealScan(r io.Reader, fn func(payload []byte, err error) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxStoreLine)
+
+	var buf []byte
+	for scanner.Scan() {
+		sealed := bytes.TrimSpace(scanner.Bytes())
+		if len(sealed) == 0 {
+			continue
+		}
+
+		payload, err := v.UnsealAppend(buf[:0], string(sealed))
+		if err == nil {
+			buf = payload
+		}
+		if !fn(payload, err) {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
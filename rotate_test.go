@@ -0,0 +1,221 @@
+package iron
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResealsPreservingExpiration(t *testing.T) {
+	v := New(Options{Secret: password, TTL: time.Hour})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	resealed, err := New(Options{Secret: password, TTL: time.Minute}).Reseal(cookie)
+	assert.Nil(t, err)
+	assert.NotEqual(t, cookie, resealed)
+
+	before, err := ParseSeal(cookie)
+	assert.Nil(t, err)
+	after, err := ParseSeal(resealed)
+	assert.Nil(t, err)
+	assert.Equal(t, before.Expiration, after.Expiration)
+
+	payload, err := v.Unseal(resealed)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+}
+
+func TestResealsRefreshingEmbeddedTTL(t *testing.T) {
+	v := New(Options{Secret: password, TTL: time.Hour, EmbedTTL: true})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	payload, info, err := v.UnsealWithInfo(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+	assert.Equal(t, time.Hour, info.OriginalTTL)
+
+	// A cookie part way through its window is given a whole window again,
+	// whatever the resealing vault's own TTL.
+	cookie, err = v.seal(&message{Expiration: time.Now().Add(10 * time.Minute), TTL: time.Hour}, source)
+	assert.Nil(t, err)
+	start := time.Now()
+	resealed, err := New(Options{Secret: password, TTL: time.Minute}).Reseal(cookie)
+	assert.Nil(t, err)
+
+	after, err := ParseSeal(resealed)
+	assert.Nil(t, err)
+	assert.WithinDuration(t, start.Add(time.Hour), after.Expiration, time.Second)
+
+	_, info, err = v.UnsealWithInfo(resealed)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Hour, info.OriginalTTL)
+}
+
+func TestResealsWithinRenewalGrace(t *testing.T) {
+	v := New(Options{Secret: password, TTL: time.Hour, RenewalGrace: 10 * time.Minute})
+	recent, err := v.seal(&message{Expiration: time.Now().Add(-5 * time.Minute)}, source)
+	assert.Nil(t, err)
+	stale, err := v.seal(&message{Expiration: time.Now().Add(-20 * time.Minute)}, source)
+	assert.Nil(t, err)
+
+	_, err = v.Unseal(recent)
+	assert.IsType(t, UnsealError{}, err)
+
+	start := time.Now()
+	resealed, err := v.Reseal(recent)
+	assert.Nil(t, err)
+	after, err := ParseSeal(resealed)
+	assert.Nil(t, err)
+	assert.WithinDuration(t, start.Add(time.Hour), after.Expiration, time.Second)
+	payload, err := v.Unseal(resealed)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = v.Reseal(stale)
+	assert.IsType(t, UnsealError{}, err)
+}
+
+func TestResealRenewsOnlyWithFreshExpiration(t *testing.T) {
+	v := New(Options{Secret: password, RenewalGrace: 10 * time.Minute})
+	recent, err := v.seal(&message{Expiration: time.Now().Add(-5 * time.Minute)}, source)
+	assert.Nil(t, err)
+
+	// Without a TTL, there's no fresh expiration to renew it with.
+	_, err = v.Reseal(recent)
+	assert.IsType(t, UnsealError{}, err)
+}
+
+func TestResealRenewsWithinMaxAge(t *testing.T) {
+	v := New(Options{Secret: password, TTL: time.Hour, RenewalGrace: 10 * time.Minute, RenewalMaxAge: time.Hour})
+	expired := time.Now().Add(-5 * time.Minute)
+	young, err := v.seal(&message{Expiration: expired, IssuedAt: time.Now().Add(-30 * time.Minute)}, source)
+	assert.Nil(t, err)
+	old, err := v.seal(&message{Expiration: expired, IssuedAt: time.Now().Add(-2 * time.Hour)}, source)
+	assert.Nil(t, err)
+	undated, err := v.seal(&message{Expiration: expired}, source)
+	assert.Nil(t, err)
+
+	resealed, err := v.Reseal(young)
+	assert.Nil(t, err)
+	before, err := ParseSeal(young)
+	assert.Nil(t, err)
+	after, err := ParseSeal(resealed)
+	assert.Nil(t, err)
+	assert.Equal(t, before.IssuedAt, after.IssuedAt)
+	assert.True(t, after.Expiration.After(time.Now()))
+
+	for _, cookie := range []string{old, undated} {
+		_, err = v.Reseal(cookie)
+		assert.IsType(t, UnsealError{}, err)
+	}
+}
+
+func TestRotatesStore(t *testing.T) {
+	v := New(Options{Secret: password})
+	a, err := v.Seal([]byte("a"))
+	assert.Nil(t, err)
+	b, err := v.Seal([]byte("b"))
+	assert.Nil(t, err)
+
+	src := strings.Join([]string{a, "garbage", "", b, a[1:]}, "\n")
+	dst := bytes.NewBuffer(nil)
+	summary, err := v.RotateStore(strings.NewReader(src), dst)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, summary.Resealed)
+	assert.Equal(t, []RotateFailure{
+		{2, UnsealError{"Incorrect number of sealed components"}},
+		{5, UnsealError{"Wrong mac prefix"}},
+	}, summary.Failed)
+
+	lines := strings.Split(strings.TrimSpace(dst.String()), "\n")
+	assert.Len(t, lines, 2)
+	for i, expected := range []string{"a", "b"} {
+		assert.NotEqual(t, a, lines[i])
+		payload, err := v.Unseal(lines[i])
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(payload))
+	}
+}
+
+// sealedFile returns n newline-delimited cookies, with every tenth line
+// replaced by garbage.
+func sealedFile(t testing.TB, v *Vault, n int) string {
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		if i%10 == 9 {
+			buf.WriteString("garbage\n")
+		} else {
+			buf.WriteString(cookie + "\n")
+		}
+	}
+	return buf.String()
+}
+
+func TestUnsealsScannedLines(t *testing.T) {
+	v := New(Options{Secret: password})
+	file := sealedFile(t, v, 10000)
+
+	var unsealed, failed int
+	err := v.UnsealScan(strings.NewReader("\n"+file), func(payload []byte, err error) bool {
+		if err != nil {
+			assert.Equal(t, UnsealError{"Incorrect number of sealed components"}, err)
+			failed++
+		} else {
+			assert.Equal(t, source, payload)
+			unsealed++
+		}
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 9000, unsealed)
+	assert.Equal(t, 1000, failed)
+
+	var seen int
+	err = v.UnsealScan(strings.NewReader(file), func(payload []byte, err error) bool {
+		seen++
+		return seen < 3
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, seen)
+}
+
+func TestUnsealScanUsesConstantMemory(t *testing.T) {
+	v := New(Options{Secret: password})
+	perLine := func(n int) float64 {
+		file := sealedFile(t, v, n)
+		return testing.AllocsPerRun(5, func() {
+			v.UnsealScan(strings.NewReader(file), func([]byte, error) bool { return true })
+		}) / float64(n)
+	}
+
+	// Scanning a hundred times as many lines allocates no more per line.
+	assert.InDelta(t, perLine(100), perLine(10000), 0.05)
+}
+
+func TestUnsealScanReusesPayloadBuffer(t *testing.T) {
+	v := New(Options{Secret: password})
+	var first *byte
+	var lines int
+	err := v.UnsealScan(strings.NewReader(sealedFile(t, v, 100)), func(payload []byte, err error) bool {
+		if err != nil {
+			return true
+		}
+		assert.Equal(t, source, payload)
+		if first == nil {
+			first = &payload[:1][0]
+		}
+		assert.True(t, first == &payload[:1][0])
+		lines++
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 90, lines)
+}
@@ -0,0 +1,141 @@
+package iron
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"regexp"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrSecretTooShort is returned when a SecretProvider supplies a secret
+// shorter than 32 bytes.
+var ErrSecretTooShort = errors.New("iron-go: secret key may not be less than 32 bytes")
+
+// passwordIDPattern matches the password IDs Node Iron accepts.
+var passwordIDPattern = regexp.MustCompile(`^\w+$`)
+
+// SecretProvider supplies the secrets used to seal and unseal cookies, so
+// that they may be rotated. Implementations must be safe for concurrent use.
+type SecretProvider interface {
+	// Current returns the ID and secret to seal new cookies with. The ID
+	// must consist only of letters, digits and underscores.
+	Current() (id string, secret []byte, err error)
+	// Lookup returns the secret with the ID, for unsealing. It should
+	// return an error if the ID is unknown.
+	Lookup(id string) ([]byte, error)
+}
+
+// SecretMap is a SecretProvider backed by a fixed set of secrets.
+type SecretMap struct {
+	// CurrentID is the ID of the secret used for sealing.
+	CurrentID string
+	// Secrets maps IDs to secrets. Cookies sealed with IDs missing from the
+	// map can't be unsealed.
+	Secrets map[string][]byte
+}
+
+// Current implements SecretProvider.Current
+func (s SecretMap) Current() (string, []byte, error) {
+	secret, err := s.Lookup(s.CurrentID)
+	return s.CurrentID, secret, err
+}
+
+// Lookup implements SecretProvider.Lookup
+func (s SecretMap) Lookup(id string) ([]byte, error) {
+	secret, ok := s.Secrets[id]
+	if !ok {
+		return nil, UnsealError{"Unknown password id"}
+	}
+
+	return secret, nil
+}
+
+// SealInfo describes how a cookie was sealed.
+type SealInfo struct {
+	// PasswordID is the ID of the secret used to seal the cookie, or empty
+	// if the vault has a single secret.
+	PasswordID string
+	// OriginalTTL is the TTL the cookie was sealed with, or zero if it was
+	// sealed without EmbedTTL.
+	OriginalTTL time.Duration
+}
+
+// info returns the SealInfo for the message.
+func (m *message) info() SealInfo {
+	return SealInfo{PasswordID: m.PasswordID, OriginalTTL: m.TTL}
+}
+
+// withSecret returns a copy of the vault which uses the secret.
+func (v *Vault) withSecret(secret []byte) (*Vault, error) {
+	if len(secret) < 32 {
+		return nil, ErrSecretTooShort
+	}
+
+	c := *v
+	c.opts.Secret = secret
+	return &c, nil
+}
+
+// currentSecret returns the current password ID and a copy of the vault
+// which seals with its secret.
+func (v *Vault) currentSecret() (string, *Vault, error) {
+	id, secret, err := v.opts.Secrets.Current()
+	if err != nil {
+		return "", nil, err
+	}
+	if !passwordIDPattern.MatchString(id) {
+		return "", nil, errors.New("iron-go: invalid password id " + id)
+	}
+
+	c, err := v.withSecret(secret)
+	return id, c, err
+}
+
+// lookupSecret returns a copy of the vault which unseals with the secret
+// having the password ID.
+func (v *Vault) lookupSecret(id string) (*Vault, error) {
+	secret, err := v.opts.Secrets.Lookup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.withSecret(secret)
+}
+
+// subjectSecrets derives each of a provider's secrets for a subject.
+type subjectSecrets struct {
+	parent    SecretProvider
+	subjectID []byte
+}
+
+func (s subjectSecrets) Current() (string, []byte, error) {
+	id, secret, err := s.parent.Current()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return id, deriveSubjectSecret(secret, s.subjectID), nil
+}
+
+func (s subjectSecrets) Lookup(id string) ([]byte, error) {
+	secret, err := s.parent.Lookup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return deriveSubjectSecret(secret, s.subjectID), nil
+}
+
+// deriveSubjectSecret derives a subject's 32-byte secret from the master
+// secret of any length using HKDF-SHA256. A single block of output is all
+// that's needed, so it's computed directly as HKDF's first block, T(1) =
+// HMAC(PRK, info || 0x01), which can't fail or run out of output.
+func deriveSubjectSecret(secret, subjectID []byte) []byte {
+	h := hmac.New(sha256.New, hkdf.Extract(sha256.New, secret, nil))
+	h.Write(subjectID)
+	h.Write([]byte{1})
+	return h.Sum(nil)
+}
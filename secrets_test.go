@@ -0,0 +1,116 @@
+package iron
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rotatingSecrets is a SecretProvider whose current secret can be changed.
+type rotatingSecrets struct {
+	mu sync.Mutex
+	SecretMap
+}
+
+func (r *rotatingSecrets) rotate(id string) {
+	r.mu.Lock()
+	r.CurrentID = id
+	r.mu.Unlock()
+}
+
+func (r *rotatingSecrets) Current() (string, []byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.SecretMap.Current()
+}
+
+func newRotatingSecrets() *rotatingSecrets {
+	return &rotatingSecrets{SecretMap: SecretMap{
+		CurrentID: "one",
+		Secrets:   map[string][]byte{"one": password, "two": rawKey},
+	}}
+}
+
+func TestSealsWithRotatingSecrets(t *testing.T) {
+	secrets := newRotatingSecrets()
+	v := New(Options{Secrets: secrets})
+
+	first, info, err := v.SealWithInfo(source)
+	assert.Nil(t, err)
+	assert.Equal(t, SealInfo{PasswordID: "one"}, info)
+
+	secrets.rotate("two")
+	second, info, err := v.SealWithInfo(source)
+	assert.Nil(t, err)
+	assert.Equal(t, SealInfo{PasswordID: "two"}, info)
+
+	for sealed, id := range map[string]string{first: "one", second: "two"} {
+		parsed, err := ParseSeal(sealed)
+		assert.Nil(t, err)
+		assert.Equal(t, id, parsed.PasswordID)
+
+		payload, info, err := v.UnsealWithInfo(sealed)
+		assert.Nil(t, err)
+		assert.Equal(t, source, payload)
+		assert.Equal(t, SealInfo{PasswordID: id}, info)
+	}
+
+	payload, err := New(Options{Secret: password}).Unseal(first)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+}
+
+func TestRejectsUnknownPasswordID(t *testing.T) {
+	cookie, err := New(Options{Secrets: SecretMap{
+		CurrentID: "three",
+		Secrets:   map[string][]byte{"three": password},
+	}}).Seal(source)
+	assert.Nil(t, err)
+
+	_, err = New(Options{Secrets: newRotatingSecrets()}).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Unknown password id"}, err)
+}
+
+func TestRejectsRevokedPasswordID(t *testing.T) {
+	secrets := newRotatingSecrets()
+	one, err := New(Options{Secrets: secrets}).Seal(source)
+	assert.Nil(t, err)
+	secrets.rotate("two")
+	two, err := New(Options{Secrets: secrets}).Seal(source)
+	assert.Nil(t, err)
+
+	v := New(Options{Secrets: secrets, RevokedPasswordIDs: map[string]bool{"one": true}})
+	_, err = v.Unseal(one)
+	assert.Equal(t, UnsealError{"Password revoked"}, err)
+	payload, err := v.Unseal(two)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+}
+
+func TestRejectsInvalidProvidedSecrets(t *testing.T) {
+	_, err := New(Options{Secrets: SecretMap{
+		CurrentID: "short",
+		Secrets:   map[string][]byte{"short": []byte("hi")},
+	}}).Seal(source)
+	assert.Equal(t, ErrSecretTooShort, err)
+
+	_, err = New(Options{Secrets: SecretMap{
+		CurrentID: "not*valid",
+		Secrets:   map[string][]byte{"not*valid": password},
+	}}).Seal(source)
+	assert.EqualError(t, err, "iron-go: invalid password id not*valid")
+}
+
+func TestSealsForSubjectWithRotatingSecrets(t *testing.T) {
+	v := New(Options{Secrets: newRotatingSecrets()})
+	cookie, err := v.ForSubject([]byte("alice")).Seal(source)
+	assert.Nil(t, err)
+
+	payload, err := v.ForSubject([]byte("alice")).Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	_, err = v.ForSubject([]byte("bob")).Unseal(cookie)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+}
@@ -0,0 +1,197 @@
+package iron
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrIVsExhausted is returned when sealing with a SessionVault which has
+// used every counter IV available to it.
+var ErrIVsExhausted = errors.New("iron-go: session IV counter exhausted")
+
+// SessionVault seals and unseals with fixed salts, deriving the keys for
+// them once rather than for every message. It's created by Vault.Session.
+//
+// Fixing the salts fixes the keys, so every message sealed in the session
+// is encrypted and authenticated under the same keys, and their uniqueness
+// rests on the random IV alone. Anyone who learns the keys can read and
+// forge every message in the session. Salts should therefore be random and
+// used for a single session only, never shared between clients or reused
+// across sessions, and sessions should be short-lived.
+type SessionVault struct {
+	v   *Vault
+	err error
+}
+
+// session holds the fixed salts of a SessionVault, and the keys derived for
+// them from a secret.
+type session struct {
+	secret           []byte
+	encSalt, intSalt []byte
+	encKey, intKey   sessionKey
+	// ivs generates counter IVs, if enabled.
+	ivs *counterIVs
+	// fixedIntSalt rejects cookies with any other integrity salt, rather
+	// than deriving a key for them.
+	fixedIntSalt bool
+}
+
+// sessionKey is a key derived for a session, with the parameters used to
+// derive it.
+type sessionKey struct {
+	bits, iterations uint
+	key              []byte
+}
+
+// Session returns a SessionVault which seals with the encryption and
+// integrity salts, which are used as the cookie's salt components verbatim.
+// Only fresh IVs are generated for each message. Cookies it seals can be
+// unsealed by any vault with the same secret, and it can unseal any cookie
+// the vault can, deriving keys as usual for cookies with other salts.
+func (v *Vault) Session(encSalt, intSalt []byte) *SessionVault {
+	for _, salt := range [][]byte{encSalt, intSalt} {
+		if !validFixedSalt(salt) {
+			return &SessionVault{err: ConfigError{"Session salts must be non-empty and may not contain separators"}}
+		}
+	}
+
+	c := *v
+	c.session = &session{secret: v.opts.Secret, encSalt: encSalt, intSalt: intSalt}
+	secretVault := &c
+	if v.opts.Secrets != nil {
+		var err error
+		if _, secretVault, err = c.currentSecret(); err != nil {
+			return &SessionVault{err: err}
+		}
+		c.session.secret = secretVault.opts.Secret
+	}
+
+	enc, integrity := v.opts.Encryption, v.opts.Integrity
+	encKey, err := secretVault.generateKey(encryptionKey, enc.derivedKeyBits(), enc.Iterations, encSalt)
+	if err != nil {
+		return &SessionVault{err: err}
+	}
+	intKey, err := secretVault.generateKey(integrityKey, integrity.KeyBits, integrity.Iterations, intSalt)
+	if err != nil {
+		return &SessionVault{err: err}
+	}
+	c.session.encKey = sessionKey{enc.derivedKeyBits(), enc.Iterations, encKey}
+	c.session.intKey = sessionKey{integrity.KeyBits, integrity.Iterations, intKey}
+	v.zero.track(encKey, intKey)
+
+	return &SessionVault{v: &c}
+}
+
+// validFixedSalt reports whether the salt may be used verbatim as a salt
+// component.
+func validFixedSalt(salt []byte) bool {
+	return len(salt) > 0 && len(salt) <= maxSaltLength &&
+		!strings.ContainsAny(string(salt), delimiter+extensionSep)
+}
+
+// Seal seals the payload like Vault.Seal, using the session's salts.
+func (s *SessionVault) Seal(b []byte) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+
+	return s.v.Seal(b)
+}
+
+// Unseal unseals the cookie like Vault.Unseal.
+func (s *SessionVault) Unseal(str string) ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return s.v.Unseal(str)
+}
+
+// WithCounterIVs returns a copy of the session which derives IVs from a
+// counter rather than reading fresh random bytes for each message. Each IV
+// is a random prefix, drawn once for the session, followed by a 64-bit
+// counter. As CBC mode requires IVs to be unpredictable as well as unique,
+// that block is then encrypted with the session's encryption key to give
+// the IV. Sealing fails with ErrIVsExhausted once the counter runs out. The
+// encryption IVBits must be at least 16 and match the cipher's block size.
+func (s *SessionVault) WithCounterIVs() *SessionVault {
+	if s.err != nil {
+		return s
+	}
+	if s.v.opts.Encryption.IVBits < 16 {
+		return &SessionVault{err: ConfigError{"Counter IVs need Encryption.IVBits of at least 16"}}
+	}
+
+	prefix, err := s.v.randomBytes(s.v.opts.Encryption.IVBits - 8)
+	if err != nil {
+		return &SessionVault{err: err}
+	}
+
+	s.v.zero.track(prefix)
+	c := *s.v
+	sess := *c.session
+	sess.ivs = &counterIVs{prefix: prefix}
+	c.session = &sess
+	return &SessionVault{v: &c}
+}
+
+// counterIVs generates the IVs of a session with counter IVs.
+type counterIVs struct {
+	prefix  []byte
+	counter uint64
+}
+
+// next returns the next IV, encrypting the prefix and counter under the key
+// with the cipher.
+func (c *counterIVs) next(cipher CipherFactory, key []byte) ([]byte, error) {
+	var n uint64
+	for {
+		n = atomic.LoadUint64(&c.counter)
+		if n == math.MaxUint64 {
+			return nil, ErrIVsExhausted
+		}
+		if atomic.CompareAndSwapUint64(&c.counter, n, n+1) {
+			break
+		}
+	}
+
+	block := make([]byte, len(c.prefix)+8)
+	copy(block, c.prefix)
+	binary.BigEndian.PutUint64(block[len(c.prefix):], n)
+
+	// A single block encrypted in CBC mode with a zero IV is encrypted
+	// with the raw block cipher.
+	encrypt, _, err := cipher(key, make([]byte, len(block)))
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, len(block))
+	encrypt.CryptBlocks(iv, block)
+	return iv, nil
+}
+
+// key returns the cached key for the derivation, or nil if there is none.
+// It may be called on a nil session.
+func (s *session) key(secret []byte, bits, iterations uint, salt []byte) []byte {
+	if s == nil || !bytes.Equal(secret, s.secret) {
+		return nil
+	}
+
+	for _, k := range []struct {
+		salt []byte
+		key  sessionKey
+	}{
+		{s.encSalt, s.encKey},
+		{s.intSalt, s.intKey},
+	} {
+		if k.key.key != nil && k.key.bits == bits && k.key.iterations == iterations && bytes.Equal(salt, k.salt) {
+			return k.key.key
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package iron
+
+import (
+	"bytes"
+	"encoding/base64"
+	"math"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	rawEncSalt = bytes.Repeat([]byte{1}, 32)
+	rawIntSalt = bytes.Repeat([]byte{2}, 32)
+	encSalt    = []byte(base64.RawURLEncoding.EncodeToString(rawEncSalt))
+	intSalt    = []byte(base64.RawURLEncoding.EncodeToString(rawIntSalt))
+)
+
+func TestSessionMatchesVaultWithSameSalts(t *testing.T) {
+	salts := [][]byte{rawEncSalt, rawIntSalt}
+	regular := New(Options{Secret: password, Rand: bytes.NewReader(make([]byte, 64)), SaltSource: func(bits uint) ([]byte, error) {
+		salt := salts[0]
+		salts = salts[1:]
+		return salt, nil
+	}})
+	expected, err := regular.Seal(source)
+	assert.Nil(t, err)
+
+	s := New(Options{Secret: password, Rand: bytes.NewReader(make([]byte, 64))}).Session(encSalt, intSalt)
+	cookie, err := s.Seal(source)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, cookie)
+
+	payload, err := New(Options{Secret: password}).Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	other, err := New(Options{Secret: password}).Seal([]byte("other"))
+	assert.Nil(t, err)
+	payload, err = s.Unseal(other)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("other"), payload)
+}
+
+func TestSessionDerivesKeysOnce(t *testing.T) {
+	var calls int32
+	s := New(Options{Secret: password, PBKDF2Hash: countingHash(&calls, nil)}).Session(encSalt, intSalt)
+	derived := atomic.LoadInt32(&calls)
+	assert.NotZero(t, derived)
+
+	for i := 0; i < 10; i++ {
+		cookie, err := s.Seal(source)
+		assert.Nil(t, err)
+		payload, err := s.Unseal(cookie)
+		assert.Nil(t, err)
+		assert.Equal(t, source, payload)
+	}
+	assert.Equal(t, derived, atomic.LoadInt32(&calls))
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct{ n int }
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	r.n += len(b)
+	return len(b), nil
+}
+
+func TestSessionDrawsOnlyIVs(t *testing.T) {
+	r := &countingReader{}
+	s := New(Options{Secret: password, Rand: r}).Session(encSalt, intSalt)
+	_, err := s.Seal(source)
+	assert.Nil(t, err)
+	assert.Equal(t, 16, r.n)
+}
+
+func TestSessionUsesCurrentSecret(t *testing.T) {
+	secrets := &SecretMap{CurrentID: "a", Secrets: map[string][]byte{"a": password, "b": rawKey}}
+	v := New(Options{Secrets: secrets})
+	s := v.Session(encSalt, intSalt)
+	cookie, err := s.Seal(source)
+	assert.Nil(t, err)
+
+	secrets.CurrentID = "b"
+	rotated, err := s.Seal(source)
+	assert.Nil(t, err)
+
+	for _, c := range []string{cookie, rotated} {
+		payload, err := v.Unseal(c)
+		assert.Nil(t, err)
+		assert.Equal(t, source, payload)
+	}
+}
+
+func TestSessionRejectsInvalidSalts(t *testing.T) {
+	v := New(Options{Secret: password})
+	for _, salts := range [][2][]byte{{nil, intSalt}, {encSalt, []byte("a*b")}, {[]byte("a=b"), intSalt}} {
+		_, err := v.Session(salts[0], salts[1]).Seal(source)
+		assert.Equal(t, ConfigError{"Session salts must be non-empty and may not contain separators"}, err)
+	}
+}
+
+func BenchmarkSessionSeal(b *testing.B) {
+	s := New(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 256, Iterations: 1000, SaltBits: 32, Cipher: AES256,
+	}}).Session(encSalt, intSalt)
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Seal(source); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVaultSealFixedSalt(b *testing.B) {
+	v := New(Options{Secret: password, Encryption: &Encryption{
+		IVBits: 16, KeyBits: 256, Iterations: 1000, SaltBits: 32, Cipher: AES256,
+	}, SaltSource: func(bits uint) ([]byte, error) { return rawEncSalt, nil }})
+	for i := 0; i < b.N; i++ {
+		if _, err := v.Seal(source); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSessionWithCounterIVs(t *testing.T) {
+	s := New(Options{Secret: password}).Session(encSalt, intSalt).WithCounterIVs()
+	regular := New(Options{Secret: password})
+
+	ivs := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		cookie, err := s.Seal(source)
+		assert.Nil(t, err)
+		iv := strings.Split(cookie, delimiter)[3]
+		assert.False(t, ivs[iv])
+		ivs[iv] = true
+
+		payload, err := regular.Unseal(cookie)
+		assert.Nil(t, err)
+		assert.Equal(t, source, payload)
+	}
+}
+
+func TestSessionCounterIVsExhaust(t *testing.T) {
+	s := New(Options{Secret: password}).Session(encSalt, intSalt).WithCounterIVs()
+	s.v.session.ivs.counter = math.MaxUint64 - 1
+
+	_, err := s.Seal(source)
+	assert.Nil(t, err)
+	_, err = s.Seal(source)
+	assert.Equal(t, ErrIVsExhausted, err)
+}
+
+func BenchmarkSessionSealCounterIVs(b *testing.B) {
+	s := New(Options{Secret: password}).Session(encSalt, intSalt).WithCounterIVs()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Seal(source); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSessionSealRandomIVs(b *testing.B) {
+	s := New(Options{Secret: password}).Session(encSalt, intSalt)
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Seal(source); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package iron
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+// ErrPayloadTooLarge is returned from Seal when the payload is longer than
+// Options.MaxPlaintextSize, and from Unseal when a compressed payload
+// inflates beyond it.
+var ErrPayloadTooLarge = errors.New("iron-go: payload exceeds maximum size")
+
+// SealedSize returns the length of the cookie which sealing a payload of n
+// bytes would produce, without sealing anything. It assumes that any
+// compression or transformers leave the payload's size unchanged, and that
+// the IV is the size of the cipher's block.
+func (v *Vault) SealedSize(n int) int {
+	msg := v.newMessage()
+	msg.prefix = v.opts.sealPrefix()
+	msg.resolution = v.opts.ExpirationResolution
+	if v.opts.Secrets != nil {
+		msg.PasswordID, _, _ = v.opts.Secrets.Current()
+	}
+	if v.opts.EmbedParameters {
+		msg.Parameters = v.Describe().parameters()
+	}
+	if len(v.opts.Transformers) > 0 {
+		msg.Transforms = v.transformChain()
+	}
+	if v.opts.Compression == CompressionAlways {
+		msg.Compressed = true
+	}
+	if v.opts.IncludeKCV {
+		msg.KCV = make([]byte, kcvSize)
+	}
+
+	if v.opts.EncryptExpiration {
+		n += expirationSize
+		msg.expirationEncrypted = true
+	}
+	if m := v.opts.Encryption.PadToMultiple; m > 0 {
+		n += padLengthSize
+		msg.padded = true
+		if rem := n % m; rem != 0 {
+			n += m - rem
+		}
+	}
+
+	if v.opts.MACOrder == MACThenEncrypt {
+		n += v.opts.Integrity.Hash().Size()
+	}
+
+	blockSize := int(v.opts.Encryption.IVBits)
+	if blockSize > 0 {
+		n += blockSize - n%blockSize
+	}
+	msg.Salt = make([]byte, base64.RawURLEncoding.EncodedLen(int(v.opts.Encryption.SaltBits)))
+	msg.IV = make([]byte, v.opts.Encryption.IVBits)
+	msg.EncryptedBody = make([]byte, n)
+	msg.HMACSalt = make([]byte, base64.RawURLEncoding.EncodedLen(int(v.opts.Integrity.SaltBits)))
+	if v.opts.MACOrder != MACThenEncrypt {
+		msg.HMAC = make([]byte, v.opts.Integrity.Hash().Size())
+	}
+
+	size := len(msg.Pack(&v.opts))
+	if v.opts.FastReject {
+		size += base64.RawURLEncoding.EncodedLen(fastTagSize) + len(delimiter)
+	}
+
+	return size
+}
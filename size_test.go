@@ -0,0 +1,46 @@
+package iron
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPredictsSealedSize(t *testing.T) {
+	for _, opts := range []Options{
+		{Secret: password},
+		{Secret: password, TTL: time.Hour, EmbedIssuedAt: true, EmbedParameters: true},
+		{Secret: password, FastReject: true, OmitPrefix: true},
+		{Secret: password, TTL: time.Hour, EncryptExpiration: true, Issuer: "svc-a"},
+		{Secret: password, Encryption: &Encryption{
+			IVBits: 16, KeyBits: 256, Iterations: 1, SaltBits: 32, Cipher: AES256, PadToMultiple: 100,
+		}},
+		{Secrets: &SecretMap{CurrentID: "current", Secrets: map[string][]byte{"current": password}}},
+	} {
+		v := New(opts)
+		for _, n := range []int{0, 1, 15, 16, 17, 1000} {
+			cookie, err := v.Seal(bytes.Repeat([]byte{'x'}, n))
+			assert.Nil(t, err)
+			assert.Equal(t, len(cookie), v.SealedSize(n))
+		}
+	}
+}
+
+func TestLimitsPlaintextSize(t *testing.T) {
+	v := New(Options{Secret: password, MaxPlaintextSize: 100})
+	_, err := v.Seal(make([]byte, 100))
+	assert.Nil(t, err)
+	_, err = v.Seal(make([]byte, 101))
+	assert.Equal(t, ErrPayloadTooLarge, err)
+
+	_, err = New(Options{Secret: password, MaxPlaintextSize: -1}).Seal(make([]byte, 10000))
+	assert.Nil(t, err)
+}
+
+func TestDefaultsToUnlimitedPlaintextSize(t *testing.T) {
+	cookie, err := New(Options{Secret: password}).Seal(make([]byte, 10000))
+	assert.Nil(t, err)
+	assert.True(t, len(cookie) > 4096)
+}
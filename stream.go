@@ -0,0 +1,312 @@
+package iron
+
+import (
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// streamChunkSize is the most plaintext SealStream puts in one frame.
+	streamChunkSize = 64 << 10
+	// maxStreamHeader bounds the sealed stream key at the start of a
+	// stream.
+	maxStreamHeader = 64 << 10
+	// frameOverhead is the size of a frame's IV and MAC, beyond its
+	// ciphertext.
+	frameOverhead = aes.BlockSize + sha256.Size
+	// sequenceSize is the size of the sequence number in sequenced frames.
+	sequenceSize = 8
+)
+
+// Frame flags, which are authenticated along with the frame.
+const (
+	// frameFinal marks the last frame of a stream, so that truncation is
+	// detected.
+	frameFinal byte = 1 << iota
+	// frameRekey marks the first frame under a key ratcheted from the
+	// previous frame's key.
+	frameRekey
+)
+
+// SealStream seals everything read from src into a stream written to dst,
+// which UnsealStream reads. The stream starts with a random stream key,
+// sealed with the vault like a cookie and subject to its TTL, followed by
+// frames of up to 64 KiB of plaintext, each encrypted and authenticated
+// under the stream key. Frames are numbered, so they can't be reordered,
+// and the last is marked, so the stream can't be truncated. If
+// Options.StreamRekeyFrames or StreamRekeyBytes is set, the stream key is
+// replaced by a key derived from it with HKDF at those intervals, bounding
+// the data under any one key. Options.OnProgress is called after each
+// frame.
+func (v *Vault) SealStream(dst io.Writer, src io.Reader) error {
+	key, err := v.writeStreamKey(dst, nil)
+	if err != nil {
+		return err
+	}
+
+	total := int64(-1)
+	if l, ok := src.(interface{ Len() int }); ok {
+		total = int64(l.Len())
+	}
+
+	fw := &frameWriter{v: v, w: dst, key: key}
+	buf := make([]byte, streamChunkSize)
+	var frames int
+	var size, processed int64
+	for {
+		n, err := io.ReadFull(src, buf)
+		var flags byte
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			flags |= frameFinal
+		default:
+			return err
+		}
+
+		if (v.opts.StreamRekeyFrames > 0 && frames >= v.opts.StreamRekeyFrames) ||
+			(v.opts.StreamRekeyBytes > 0 && size >= v.opts.StreamRekeyBytes) {
+			fw.key = ratchetStreamKey(fw.key)
+			flags |= frameRekey
+			frames, size = 0, 0
+		}
+		if err := fw.write(flags, buf[:n]); err != nil {
+			return err
+		}
+		frames++
+		size += int64(n)
+		processed += int64(n)
+		v.progress(processed, total)
+
+		if flags&frameFinal != 0 {
+			return nil
+		}
+	}
+}
+
+// UnsealStream unseals a stream sealed by SealStream from src, writing the
+// plaintext to dst as each frame is verified. It returns an UnsealError if
+// any frame is invalid or the stream is truncated, in which case whatever
+// was already written to dst must be discarded. Options.OnProgress is
+// called after each frame, with an unknown total.
+func (v *Vault) UnsealStream(dst io.Writer, src io.Reader) error {
+	key, err := v.readStreamKey(src, nil)
+	if err != nil {
+		return err
+	}
+
+	fr := &frameReader{r: src, key: key}
+	var processed int64
+	for {
+		flags, plaintext, err := fr.read(streamChunkSize)
+		if err != nil {
+			return err
+		}
+		if _, err := dst.Write(plaintext); err != nil {
+			return err
+		}
+		processed += int64(len(plaintext))
+		v.progress(processed, -1)
+		if flags&frameFinal != 0 {
+			return nil
+		}
+	}
+}
+
+// writeStreamKey generates a random stream key and writes it to w, sealed
+// with the vault and any additional data, returning the key.
+func (v *Vault) writeStreamKey(w io.Writer, aad []byte) ([]byte, error) {
+	key, err := v.randomBytes(multiKeySize)
+	if err != nil {
+		return nil, err
+	}
+	msg := v.newMessage()
+	msg.aad = aad
+	header, err := v.seal(msg, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFrameLength(w, len(header)); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, header); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// readStreamKey reads and unseals a stream key written by writeStreamKey
+// with the same additional data.
+func (v *Vault) readStreamKey(r io.Reader, aad []byte) ([]byte, error) {
+	n, err := readFrameLength(r, maxStreamHeader)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, n)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, UnsealError{"Truncated stream"}
+	}
+	_, key, err := v.unsealFor("", aad, string(header))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != multiKeySize {
+		return nil, UnsealError{"Invalid content key"}
+	}
+
+	return key, nil
+}
+
+// progress reports progress to Options.OnProgress, if it's set.
+func (v *Vault) progress(processed, total int64) {
+	if v.opts.OnProgress != nil {
+		v.opts.OnProgress(processed, total)
+	}
+}
+
+// frameWriter encrypts and authenticates frames under a stream key.
+type frameWriter struct {
+	v   *Vault
+	w   io.Writer
+	key []byte
+	seq uint64
+	// sequenced writes each frame's sequence number after its flags. It's
+	// authenticated either way.
+	sequenced bool
+}
+
+// write writes the plaintext as the next frame, with the flags.
+func (f *frameWriter) write(flags byte, b []byte) error {
+	iv, err := f.v.randomBytes(aes.BlockSize)
+	if err != nil {
+		return err
+	}
+	encrypt, _, err := AES256(f.key[:32], iv)
+	if err != nil {
+		return err
+	}
+	ciphertext := encryptPadded(encrypt, b, false)
+
+	frame := make([]byte, 0, 5+sequenceSize+frameOverhead+len(ciphertext))
+	frame = append(frame, 0, 0, 0, 0, flags)
+	binary.BigEndian.PutUint32(frame, uint32(len(iv)+len(ciphertext)+sha256.Size))
+	if f.sequenced {
+		frame = frame[:5+sequenceSize]
+		binary.BigEndian.PutUint64(frame[5:], f.seq)
+	}
+	signed := len(frame)
+	frame = append(frame, iv...)
+	frame = append(frame, ciphertext...)
+	frame = append(frame, frameMAC(f.key, f.seq, flags, frame[signed:])...)
+	f.seq++
+
+	_, err = f.w.Write(frame)
+	return err
+}
+
+// frameReader verifies and decrypts frames written by a frameWriter.
+type frameReader struct {
+	r   io.Reader
+	key []byte
+	seq uint64
+	// sequenced reads each frame's sequence number after its flags, as
+	// written by a sequenced frameWriter, and rejects frames out of order.
+	sequenced bool
+}
+
+// read reads, verifies and decrypts the next frame, which may hold up to
+// max bytes of plaintext.
+func (f *frameReader) read(max int) (byte, []byte, error) {
+	n, err := readFrameLength(f.r, max+aes.BlockSize+frameOverhead)
+	if err != nil {
+		return 0, nil, err
+	}
+	header := 1
+	if f.sequenced {
+		header += sequenceSize
+	}
+	body := make([]byte, header+n)
+	if _, err := io.ReadFull(f.r, body); err != nil {
+		return 0, nil, UnsealError{"Truncated stream"}
+	}
+	flags := body[0]
+	if f.sequenced && binary.BigEndian.Uint64(body[1:]) != f.seq {
+		return 0, nil, UnsealError{"Frame sequence error"}
+	}
+	body = body[header:]
+	if n < frameOverhead+aes.BlockSize || (n-frameOverhead)%aes.BlockSize != 0 {
+		return 0, nil, UnsealError{"Invalid stream frame"}
+	}
+
+	if flags&frameRekey != 0 {
+		f.key = ratchetStreamKey(f.key)
+	}
+	signed, mac := body[:n-sha256.Size], body[n-sha256.Size:]
+	if !hmac.Equal(mac, frameMAC(f.key, f.seq, flags, signed)) {
+		return 0, nil, UnsealError{"Bad hmac value"}
+	}
+	f.seq++
+
+	_, decrypt, err := AES256(f.key[:32], signed[:aes.BlockSize])
+	if err != nil {
+		return 0, nil, err
+	}
+	data := make([]byte, len(signed)-aes.BlockSize)
+	decrypt.CryptBlocks(data, signed[aes.BlockSize:])
+	plaintext, err := unpad(data, aes.BlockSize)
+	return flags, plaintext, err
+}
+
+// frameMAC authenticates a frame's IV and ciphertext, along with its flags
+// and sequence number.
+func frameMAC(key []byte, seq uint64, flags byte, signed []byte) []byte {
+	var prefix [9]byte
+	binary.BigEndian.PutUint64(prefix[:], seq)
+	prefix[8] = flags
+
+	h := hmac.New(sha256.New, key[32:])
+	h.Write(prefix[:])
+	h.Write(signed)
+	return h.Sum(nil)
+}
+
+// ratchetStreamKey derives the next stream key from the current one. The
+// current key can't be recovered from the next.
+func ratchetStreamKey(key []byte) []byte {
+	next := make([]byte, len(key))
+	kdf := hkdf.New(sha256.New, key, nil, []byte("iron-go stream rekey"))
+	if _, err := io.ReadFull(kdf, next); err != nil {
+		panic("iron-go: cannot ratchet stream key: " + err.Error())
+	}
+
+	return next
+}
+
+// writeFrameLength writes a frame length as a big-endian uint32.
+func writeFrameLength(w io.Writer, n int) error {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(n))
+	_, err := w.Write(b[:])
+	return err
+}
+
+// readFrameLength reads a frame length written by writeFrameLength. It
+// returns an UnsealError if the length exceeds max, or the stream ends.
+func readFrameLength(r io.Reader, max int) (int, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, UnsealError{"Truncated stream"}
+	}
+	n := binary.BigEndian.Uint32(b[:])
+	if uint64(n) > uint64(max) {
+		return 0, UnsealError{"Invalid stream frame"}
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,117 @@
+package iron
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// streamFrames splits a sealed stream into its header and frames, each
+// including its length and flags.
+func streamFrames(t *testing.T, stream []byte) ([]byte, [][]byte) {
+	n := 4 + int(binary.BigEndian.Uint32(stream))
+	header, rest := stream[:n], stream[n:]
+
+	var frames [][]byte
+	for len(rest) > 0 {
+		n := 5 + int(binary.BigEndian.Uint32(rest))
+		if !assert.True(t, n <= len(rest)) {
+			break
+		}
+		frames = append(frames, rest[:n])
+		rest = rest[n:]
+	}
+
+	return header, frames
+}
+
+func TestSealsStreams(t *testing.T) {
+	v := New(Options{Secret: password})
+	for _, size := range []int{0, 1, streamChunkSize, 3*streamChunkSize + 100} {
+		payload := bytes.Repeat([]byte{'x'}, size)
+		var sealed, unsealed bytes.Buffer
+		assert.Nil(t, v.SealStream(&sealed, bytes.NewReader(payload)))
+		assert.Nil(t, v.UnsealStream(&unsealed, bytes.NewReader(sealed.Bytes())))
+		assert.Equal(t, string(payload), unsealed.String())
+	}
+}
+
+func TestReportsStreamProgress(t *testing.T) {
+	type progress struct{ processed, total int64 }
+	var calls []progress
+	v := New(Options{Secret: password, OnProgress: func(processed, total int64) {
+		calls = append(calls, progress{processed, total})
+	}})
+
+	payload := bytes.Repeat([]byte{'x'}, 3*streamChunkSize+100)
+	var sealed, unsealed bytes.Buffer
+	assert.Nil(t, v.SealStream(&sealed, bytes.NewReader(payload)))
+	total := int64(len(payload))
+	assert.Equal(t, []progress{
+		{streamChunkSize, total},
+		{2 * streamChunkSize, total},
+		{3 * streamChunkSize, total},
+		{total, total},
+	}, calls)
+
+	calls = nil
+	assert.Nil(t, v.UnsealStream(&unsealed, bytes.NewReader(sealed.Bytes())))
+	assert.Len(t, calls, 4)
+	for i, call := range calls {
+		assert.Equal(t, int64(-1), call.total)
+		if i > 0 {
+			assert.True(t, call.processed > calls[i-1].processed)
+		}
+	}
+	assert.Equal(t, total, calls[len(calls)-1].processed)
+
+	// Sources without a length have an unknown total.
+	calls = nil
+	sealed.Reset()
+	assert.Nil(t, v.SealStream(&sealed, struct{ io.Reader }{bytes.NewReader(payload)}))
+	assert.Len(t, calls, 4)
+	assert.Equal(t, progress{total, -1}, calls[3])
+}
+
+func TestRekeysStreams(t *testing.T) {
+	v := New(Options{Secret: password, StreamRekeyFrames: 2})
+	payload := bytes.Repeat([]byte("0123456789"), 7*streamChunkSize/10)
+	var sealed bytes.Buffer
+	assert.Nil(t, v.SealStream(&sealed, bytes.NewReader(payload)))
+
+	header, frames := streamFrames(t, sealed.Bytes())
+	var rekeys int
+	for _, frame := range frames {
+		if frame[4]&frameRekey != 0 {
+			rekeys++
+		}
+	}
+	assert.Equal(t, 3, rekeys)
+
+	// The reader follows the rekeys without being configured for them.
+	var unsealed bytes.Buffer
+	assert.Nil(t, New(Options{Secret: password}).UnsealStream(&unsealed, bytes.NewReader(sealed.Bytes())))
+	assert.Equal(t, payload, unsealed.Bytes())
+
+	byBytes := New(Options{Secret: password, StreamRekeyBytes: streamChunkSize})
+	sealed.Reset()
+	assert.Nil(t, byBytes.SealStream(&sealed, bytes.NewReader(payload)))
+	unsealed.Reset()
+	assert.Nil(t, v.UnsealStream(&unsealed, bytes.NewReader(sealed.Bytes())))
+	assert.Equal(t, payload, unsealed.Bytes())
+
+	// Frames can't be reordered, dropped or tampered with.
+	join := func(frames ...[]byte) *bytes.Reader {
+		return bytes.NewReader(bytes.Join(append([][]byte{header}, frames...), nil))
+	}
+	assert.Equal(t, UnsealError{"Bad hmac value"}, v.UnsealStream(&unsealed, join(frames[1], frames[0])))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, v.UnsealStream(&unsealed, join(frames[0], frames[2])))
+	assert.Equal(t, UnsealError{"Truncated stream"}, v.UnsealStream(&unsealed, join(frames[:3]...)))
+
+	tampered := append([]byte(nil), frames[2]...)
+	tampered[len(tampered)-40] ^= 1
+	assert.Equal(t, UnsealError{"Bad hmac value"}, v.UnsealStream(&unsealed, join(frames[0], frames[1], tampered)))
+}
@@ -1,8 +1,12 @@
 package iron
 
 import (
-	"crypto/rand"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"strconv"
 	"strings"
 	"time"
@@ -12,62 +16,328 @@ var (
 	macFormatVersion = "2"
 	macPrefix        = "Fe26." + macFormatVersion
 	delimiter        = "*"
+	// extensionSep separates the name and value of the optional components
+	// iron-go may add between the expiration and the HMAC salt. It never
+	// appears in base64url or hex, so extensions can't be mistaken for the
+	// standard components.
+	extensionSep = "="
+	// formatVersion is the version of iron-go's extensions to the format,
+	// distinct from the MAC format version. Seals carrying extensions also
+	// carry it, so a library which doesn't understand them can say so.
+	formatVersion = "1"
+	// kcvInput is the fixed string HMACed for a key check value, of which
+	// the first kcvSize bytes are kept.
+	kcvInput = "iron-go kcv"
+	kcvSize  = 4
+	// maxSaltLength bounds the salt components, well above the 43
+	// base64url characters of the default 32-byte salts and the 64 hex
+	// characters of Node Iron's.
+	maxSaltLength = 1024
 )
 
 type message struct {
-	base string // this is the cookie message excluding the hmac and salt
+	base   string // this is the cookie message excluding the hmac and salt
+	prefix string // the MAC prefix, or empty for the default
+	aad    []byte // additional data covered by the hmac, but not packed
 
+	// resolution is the unit the expiration is packed in.
+	resolution TimestampResolution
+
+	// decrypted holds the payload if it was decrypted to be verified, as
+	// in MAC-then-encrypt mode.
+	decrypted []byte
+
+	// expirationEncrypted is set when the expiration is encrypted into the
+	// body rather than packed as a cleartext component. It's recorded in
+	// the authenticated "exp" extension, so that unsealing needn't rely on
+	// the vault's options.
+	expirationEncrypted bool
+
+	// padded is set when the plaintext was padded with its length before
+	// encryption. It's recorded in the authenticated "pad" extension.
+	padded bool
+
+	// extra holds any components after the HMAC, which are never verified.
+	extra []string
+
+	PasswordID    string
 	Salt          []byte
 	IV            []byte
 	EncryptedBody []byte
 	Expiration    time.Time
+	IssuedAt      time.Time
+	TTL           time.Duration
+	Header        []byte
+	Purpose       string
+	Issuer        string
+	Audience      string
+	Compressed    bool
+	KCV           []byte
+	Parameters    string
+	Transforms    string
 	HMACSalt      []byte
 	HMAC          []byte
 }
 
 // Unpack attempts to populate the message by unmarshaling the provided string.
 // It returns an UnsealError if the string isn't valid.
-func (m *message) Unpack(s string) error {
+func (m *message) Unpack(s string, o *Options) error {
+	if o.OmitPrefix {
+		s = o.sealPrefix() + delimiter + s
+	}
+
 	parts := strings.Split(s, delimiter)
-	if len(parts) != 8 {
+	if len(parts) < 8 {
+		return UnsealError{"Incorrect number of sealed components"}
+	}
+
+	// Any extensions sit between the expiration and the HMAC salt, and are
+	// therefore part of the MAC base.
+	n := 6
+	for n < len(parts) && strings.Contains(parts[n], extensionSep) {
+		n++
+	}
+	if len(parts) < n+2 || (len(parts) > n+2 && o.forwardCompatMode() == ForwardCompatStrict) {
 		return UnsealError{"Incorrect number of sealed components"}
 	}
-	if parts[0] != macPrefix {
+	if o.Base64Alphabet != "" {
+		if err := o.translateComponents(parts, n, o.Base64Alphabet, base64Alphabet); err != nil {
+			return err
+		}
+	}
+	if !o.acceptsPrefix(parts[0]) {
 		return UnsealError{"Wrong mac prefix"}
 	}
 	if len(parts[5]) > 0 {
-		exp, err := strconv.ParseInt(parts[5], 10, 64)
+		exp, err := o.ExpirationResolution.parse(parts[5])
 		if err != nil {
 			return UnsealError{"Invalid expiration time"}
 		}
-		m.Expiration = time.Unix(0, exp*int64(time.Millisecond))
+		m.Expiration = exp
+	}
+	// An empty salt would derive the same weak key for every seal.
+	for _, salt := range []string{parts[2], parts[n]} {
+		if salt == "" {
+			return UnsealError{"Missing salt"}
+		}
+		if len(salt) > maxSaltLength {
+			return UnsealError{"Invalid salt length"}
+		}
 	}
 
-	errs := []error{
-		base64decodeInto(&m.IV, parts[3]),
-		base64decodeInto(&m.EncryptedBody, parts[4]),
-		base64decodeInto(&m.HMAC, parts[7]),
+	if o.StrictSaltLength {
+		if len(parts[2]) != base64.RawURLEncoding.EncodedLen(int(o.Encryption.SaltBits)) ||
+			len(parts[n]) != base64.RawURLEncoding.EncodedLen(int(o.Integrity.SaltBits)) {
+			return UnsealError{"Unexpected salt length"}
+		}
 	}
 
-	for _, err := range errs {
-		if err != nil {
+	// Check the format version first, since a newer version may well use
+	// extensions this one doesn't know.
+	for _, ext := range parts[6:n] {
+		if strings.HasPrefix(ext, "v"+extensionSep) && ext[2:] != formatVersion {
+			return UnsealError{"Unsupported iron-go format version " + ext[2:]}
+		}
+	}
+	for _, ext := range parts[6:n] {
+		if err := m.unpackExtension(ext); err != nil {
+			return err
+		}
+	}
+
+	components := []struct {
+		index  int
+		name   string
+		target *[]byte
+		decode func(*[]byte, string) error
+	}{
+		{3, "iv", &m.IV, base64decodeInto},
+		{4, "body", &m.EncryptedBody, base64decodeInto},
+		{n + 1, "hmac", &m.HMAC, o.HMACEncoding.decodeInto},
+	}
+
+	for _, c := range components {
+		if err := c.decode(c.target, parts[c.index]); err != nil {
+			if o.VerboseErrors {
+				// Report the index in the caller's string, which lacks
+				// the prefix under OmitPrefix, and under FastReject
+				// began with the tag verify has stripped.
+				index := c.index
+				if o.OmitPrefix {
+					index--
+				}
+				if o.FastReject {
+					index++
+				}
+				return UnsealError{fmt.Sprintf("Invalid component encoding: component %d (%s): %s", index, c.name, err)}
+			}
 			return UnsealError{"Invalid component encoding"}
 		}
 	}
 
+	m.prefix = parts[0]
+	m.PasswordID = parts[1]
 	m.Salt = []byte(parts[2])
-	m.HMACSalt = []byte(parts[6])
-	m.base = s[0 : len(s)-len(parts[7])-1-len(parts[6])-1]
+	m.HMACSalt = []byte(parts[n])
+	m.base = strings.Join(parts[:n], delimiter)
+	if len(parts) > n+2 {
+		m.extra = parts[n+2:]
+	}
 	return nil
 }
 
-// Pack serializes the message into a cookie string.
-func (m *message) Pack() string {
-	return strings.Join([]string{
+// unpackExtension populates the message from a single "name=value"
+// extension component. It returns an UnsealError if the extension is
+// unknown or its value is invalid.
+func (m *message) unpackExtension(ext string) error {
+	i := strings.Index(ext, extensionSep)
+	name, value := ext[:i], ext[i+1:]
+
+	switch name {
+	case "v":
+		// Checked by Unpack.
+	case "iat":
+		iat, err := parseTimestamp(value)
+		if err != nil {
+			return UnsealError{"Invalid issued-at time"}
+		}
+		m.IssuedAt = iat
+	case "ttl":
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || ms <= 0 {
+			return UnsealError{"Invalid TTL"}
+		}
+		m.TTL = time.Duration(ms) * time.Millisecond
+	case "cmp":
+		if value != "deflate" {
+			return UnsealError{"Unknown compression"}
+		}
+		m.Compressed = true
+	case "exp":
+		if value != "encrypted" || !m.Expiration.IsZero() {
+			return UnsealError{"Invalid expiration time"}
+		}
+		m.expirationEncrypted = true
+	case "pad":
+		if value != "length" {
+			return UnsealError{"Unknown padding"}
+		}
+		m.padded = true
+	case "kcv":
+		if err := base64decodeInto(&m.KCV, value); err != nil || len(m.KCV) != kcvSize {
+			return UnsealError{"Invalid key check value"}
+		}
+	case "par":
+		if _, err := parseParameters(value); err != nil {
+			return err
+		}
+		m.Parameters = value
+	case "iss":
+		var issuer []byte
+		if err := base64decodeInto(&issuer, value); err != nil || len(issuer) == 0 {
+			return UnsealError{"Invalid component encoding"}
+		}
+		m.Issuer = string(issuer)
+	case "aud":
+		var audience []byte
+		if err := base64decodeInto(&audience, value); err != nil || len(audience) == 0 {
+			return UnsealError{"Invalid component encoding"}
+		}
+		m.Audience = string(audience)
+	case "tx":
+		if !validTransformChain(value) {
+			return UnsealError{"Invalid transformer chain"}
+		}
+		m.Transforms = value
+	case "hdr":
+		if err := base64decodeInto(&m.Header, value); err != nil {
+			return UnsealError{"Invalid component encoding"}
+		}
+	case "pur":
+		var purpose []byte
+		if err := base64decodeInto(&purpose, value); err != nil {
+			return UnsealError{"Invalid component encoding"}
+		}
+		m.Purpose = string(purpose)
+	default:
+		return UnsealError{"Unknown sealed component"}
+	}
+
+	return nil
+}
+
+// extensions returns the "name=value" extension components of the message
+// in the order they appear in the MAC base.
+func (m *message) extensions() []string {
+	var exts []string
+	if !m.IssuedAt.IsZero() {
+		exts = append(exts, "iat"+extensionSep+formatTimestamp(m.IssuedAt))
+	}
+	if m.Header != nil {
+		exts = append(exts, "hdr"+extensionSep+base64.RawURLEncoding.EncodeToString(m.Header))
+	}
+	if m.Purpose != "" {
+		exts = append(exts, "pur"+extensionSep+base64.RawURLEncoding.EncodeToString([]byte(m.Purpose)))
+	}
+	if m.TTL > 0 {
+		exts = append(exts, "ttl"+extensionSep+strconv.FormatInt(int64(m.TTL/time.Millisecond), 10))
+	}
+	if m.Issuer != "" {
+		exts = append(exts, "iss"+extensionSep+base64.RawURLEncoding.EncodeToString([]byte(m.Issuer)))
+	}
+	if m.Audience != "" {
+		exts = append(exts, "aud"+extensionSep+base64.RawURLEncoding.EncodeToString([]byte(m.Audience)))
+	}
+	if m.Parameters != "" {
+		exts = append(exts, "par"+extensionSep+m.Parameters)
+	}
+	if m.Transforms != "" {
+		exts = append(exts, "tx"+extensionSep+m.Transforms)
+	}
+	if m.Compressed {
+		exts = append(exts, "cmp"+extensionSep+"deflate")
+	}
+	if m.KCV != nil {
+		exts = append(exts, "kcv"+extensionSep+base64.RawURLEncoding.EncodeToString(m.KCV))
+	}
+	if m.expirationEncrypted {
+		exts = append(exts, "exp"+extensionSep+"encrypted")
+	}
+	if m.padded {
+		exts = append(exts, "pad"+extensionSep+"length")
+	}
+	if exts != nil {
+		exts = append(exts, "v"+extensionSep+formatVersion)
+	}
+
+	return exts
+}
+
+// Pack serializes the message into a cookie string. The HMAC salt and HMAC
+// follow the base after a single delimiter, as in Node Iron. The "**" often
+// seen before the salt is not a separate delimiter, but the empty expiration
+// component of a seal without a TTL.
+func (m *message) Pack(o *Options) string {
+	packed := strings.Join([]string{
 		m.Base(),
 		string(m.HMACSalt),
-		base64.RawURLEncoding.EncodeToString(m.HMAC),
+		o.HMACEncoding.encode(m.HMAC),
 	}, delimiter)
+
+	// The MAC base always uses the standard alphabet, so only the packed
+	// cookie is translated. Characters outside it, such as in salts given
+	// to a session, are left as they are.
+	if o.Base64Alphabet != "" {
+		parts := strings.Split(packed, delimiter)
+		o.translateComponents(parts, len(parts)-2, base64Alphabet, o.Base64Alphabet)
+		packed = strings.Join(parts, delimiter)
+	}
+
+	if o.OmitPrefix {
+		return strings.TrimPrefix(packed, m.macPrefix()+delimiter)
+	}
+
+	return packed
 }
 
 // Base returns the MAC base string, which is the cookie excluding the
@@ -78,34 +348,293 @@ func (m *message) Base() string {
 	}
 
 	parts := []string{
-		macPrefix,
-		"", // todo: password rotation component
+		m.macPrefix(),
+		m.PasswordID,
 		string(m.Salt),
 		base64.RawURLEncoding.EncodeToString(m.IV),
 		base64.RawURLEncoding.EncodeToString(m.EncryptedBody),
 		"",
 	}
 
-	if !m.Expiration.IsZero() {
-		parts[5] = strconv.FormatInt(m.Expiration.UnixNano()/int64(time.Millisecond), 10)
+	if !m.Expiration.IsZero() && !m.expirationEncrypted {
+		parts[5] = m.resolution.format(m.Expiration)
 	}
 
+	parts = append(parts, m.extensions()...)
 	m.base = strings.Join(parts, delimiter)
 	return m.base
 }
 
+// macPrefix returns the message's MAC prefix.
+func (m *message) macPrefix() string {
+	if m.prefix == "" {
+		return macPrefix
+	}
+
+	return m.prefix
+}
+
+// sealPrefix returns the MAC prefix for Options.MACFormatVersion.
+func (o *Options) sealPrefix() string {
+	if o.MACFormatVersion == "" {
+		return macPrefix
+	}
+
+	return "Fe26." + o.MACFormatVersion
+}
+
+// acceptsPrefix reports whether the MAC prefix is one of
+// Options.AcceptedMACVersions, or the MACFormatVersion if none are listed.
+func (o *Options) acceptsPrefix(prefix string) bool {
+	if len(o.AcceptedMACVersions) == 0 {
+		return prefix == o.sealPrefix()
+	}
+	for _, version := range o.AcceptedMACVersions {
+		if prefix == "Fe26."+version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// plaintextBase returns the MAC base with the salt, IV and body components
+// left empty, for MAC-then-encrypt mode, where the plaintext is MACed
+// before it's encrypted instead. When sealing, it's called before the
+// message is encrypted, so the incomplete base isn't cached.
+func (m *message) plaintextBase() string {
+	cached := m.base
+	parts := strings.Split(m.Base(), delimiter)
+	m.base = cached
+	parts[2], parts[3], parts[4] = "", "", ""
+	return strings.Join(parts, delimiter)
+}
+
+// macInput returns the data to MAC for the base and additional data. The
+// base never contains a NUL, so the two can't be confused.
+func macInput(base string, aad []byte) string {
+	if len(aad) == 0 {
+		return base
+	}
+
+	return base + "\x00" + string(aad)
+}
+
+// formatTimestamp formats the time as Unix milliseconds, like Node does.
+func formatTimestamp(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+// parseTimestamp parses a Unix millisecond timestamp.
+func parseTimestamp(s string) (time.Time, error) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(0, ms*int64(time.Millisecond)), nil
+}
+
+// TimestampResolution selects the unit of the expiration component.
+type TimestampResolution int
+
+const (
+	// Milliseconds encodes expirations as Unix milliseconds, like Node Iron.
+	// It's the default.
+	Milliseconds TimestampResolution = iota
+	// Seconds encodes expirations as Unix seconds.
+	Seconds
+)
+
+// maxSecondsTimestamp is the largest expiration accepted in seconds, in the
+// year 5138. Millisecond timestamps since 1973 all exceed it, so they're
+// rejected rather than read as a far-future expiration.
+const maxSecondsTimestamp = 1e11
+
+// format formats the time in the resolution.
+func (r TimestampResolution) format(t time.Time) string {
+	if r == Seconds {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+
+	return formatTimestamp(t)
+}
+
+// parse parses a timestamp in the resolution.
+func (r TimestampResolution) parse(s string) (time.Time, error) {
+	if r != Seconds {
+		return parseTimestamp(s)
+	}
+
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if sec > maxSecondsTimestamp {
+		return time.Time{}, errors.New("timestamp out of range")
+	}
+
+	return time.Unix(sec, 0), nil
+}
+
+// expirationSize is the length of the expiration prefixed to payloads when
+// Options.EncryptExpiration is set.
+const expirationSize = 8
+
+// joinExpiration prefixes the payload with the expiration, as big-endian
+// Unix milliseconds, or zero if the expiration is zero.
+func joinExpiration(expiration time.Time, b []byte) []byte {
+	var ms int64
+	if !expiration.IsZero() {
+		ms = expiration.UnixNano() / int64(time.Millisecond)
+	}
+
+	joined := make([]byte, expirationSize, expirationSize+len(b))
+	binary.BigEndian.PutUint64(joined, uint64(ms))
+	return append(joined, b...)
+}
+
+// splitExpiration reverses joinExpiration, returning the expiration and the
+// payload.
+func splitExpiration(b []byte) (time.Time, []byte, error) {
+	if len(b) < expirationSize {
+		return time.Time{}, nil, UnsealError{"Missing encrypted expiration"}
+	}
+
+	ms := int64(binary.BigEndian.Uint64(b))
+	if ms == 0 {
+		return time.Time{}, b[expirationSize:], nil
+	}
+
+	return time.Unix(0, ms*int64(time.Millisecond)), b[expirationSize:], nil
+}
+
+// padLengthSize is the length of the true payload length prefixed to
+// payloads padded by padToMultiple.
+const padLengthSize = 4
+
+// padToMultiple prefixes the payload with its length, as a big-endian
+// uint32, and pads it with zeroes up to a multiple of m bytes.
+func padToMultiple(b []byte, m int) []byte {
+	n := padLengthSize + len(b)
+	if rem := n % m; rem != 0 {
+		n += m - rem
+	}
+
+	padded := make([]byte, n)
+	binary.BigEndian.PutUint32(padded, uint32(len(b)))
+	copy(padded[padLengthSize:], b)
+	return padded
+}
+
+// unpadMultiple reverses padToMultiple.
+func unpadMultiple(b []byte) ([]byte, error) {
+	if len(b) < padLengthSize {
+		return nil, UnsealError{"Invalid padding"}
+	}
+
+	n := binary.BigEndian.Uint32(b)
+	if uint64(n) > uint64(len(b)-padLengthSize) {
+		return nil, UnsealError{"Invalid padding"}
+	}
+
+	return b[padLengthSize : padLengthSize+int(n)], nil
+}
+
+// HMACEncoding selects how the HMAC component of a cookie is encoded. The
+// other components are unaffected.
+type HMACEncoding int
+
+const (
+	// Base64URL encodes the HMAC as unpadded base64url, like Node Iron. It's
+	// the default.
+	Base64URL HMACEncoding = iota
+	// Hex encodes the HMAC as lowercase hex.
+	Hex
+	// Base64Std encodes the HMAC as padded standard base64, as some other
+	// implementations do.
+	Base64Std
+)
+
+// String returns the name of the encoding.
+func (e HMACEncoding) String() string {
+	switch e {
+	case Base64URL:
+		return "Base64URL"
+	case Hex:
+		return "Hex"
+	case Base64Std:
+		return "Base64Std"
+	}
+
+	return "HMACEncoding(" + strconv.Itoa(int(e)) + ")"
+}
+
+// encode encodes the HMAC.
+func (e HMACEncoding) encode(b []byte) string {
+	switch e {
+	case Hex:
+		return hex.EncodeToString(b)
+	case Base64Std:
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeInto decodes the HMAC into the target address. It returns an error
+// if the source is invalid. Although lowercase hex is valid base64url, a hex
+// HMAC is rejected rather than misread when expecting base64: the chance of
+// a genuine base64 digest consisting only of hex digits is negligible.
+func (e HMACEncoding) decodeInto(target *[]byte, src string) error {
+	if e == Hex {
+		res, err := hex.DecodeString(src)
+		*target = res
+		return err
+	}
+	if isHex(src) {
+		return errors.New("hmac is hex encoded")
+	}
+	if e == Base64Std {
+		res, err := base64.StdEncoding.DecodeString(src)
+		*target = res
+		return err
+	}
+
+	return base64decodeInto(target, src)
+}
+
+// isHex reports whether the string is non-empty, even-length lowercase hex.
+func isHex(s string) bool {
+	if len(s) == 0 || len(s)%2 != 0 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
 // base64decodeInto attempts to base64 decode the source string into the
 // target address. It returns an error if the source is invalid.
 func base64decodeInto(target *[]byte, src string) error {
+	// The decoder skips line breaks, which would let a component be
+	// encoded in more than one way.
+	if strings.ContainsAny(src, "\r\n") {
+		return errors.New("illegal line break in base64 data")
+	}
 	res, err := base64.RawURLEncoding.DecodeString(src)
 	*target = res
 	return err
 }
 
-// randBits creates and returns n random bits.
-func randBits(n uint) ([]byte, error) {
+// randBits creates and returns n random bits read from r.
+func randBits(r io.Reader, n uint) ([]byte, error) {
 	b := make([]byte, n)
-	_, err := rand.Read(b)
+	_, err := io.ReadFull(r, b)
 	return b, err
 }
 
@@ -114,3 +643,39 @@ type UnsealError struct{ message string }
 
 // Error implements error.Error
 func (u UnsealError) Error() string { return u.message }
+
+// Is reports whether the target is ErrExpired and the seal had expired.
+func (u UnsealError) Is(target error) bool {
+	return target == ErrExpired && strings.HasPrefix(u.message, expiredPrefix)
+}
+
+// PayloadError is returned when a cookie unseals, so is authentic, but its
+// payload then fails validation, such as by UnsealString or UnsealJSON. It
+// carries the decrypted payload for debugging, so shouldn't be logged
+// carelessly. Failures to authenticate or decrypt never carry a payload.
+type PayloadError struct {
+	// Payload is the decrypted payload.
+	Payload []byte
+	// Err is the reason the payload failed validation.
+	Err error
+}
+
+// Error implements error.Error
+func (p PayloadError) Error() string { return p.Err.Error() }
+
+// Unwrap returns the reason the payload failed validation.
+func (p PayloadError) Unwrap() error { return p.Err }
+
+// ErrExpired matches, via errors.Is, the UnsealError returned from Unseal
+// when a seal has expired.
+var ErrExpired = errors.New("iron-go: seal expired")
+
+// expiredPrefix begins the message of the UnsealError for expired seals.
+const expiredPrefix = "Expired "
+
+// expiredError returns the UnsealError for a seal which expired the given
+// time ago, beyond the permitted clock skew. Its message includes both, so
+// that clock problems stand out in logs.
+func expiredError(ago, skew time.Duration) UnsealError {
+	return UnsealError{fmt.Sprintf(expiredPrefix+"%s ago (skew %s)", ago.Round(time.Millisecond), skew)}
+}
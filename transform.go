@@ -0,0 +1,182 @@
+package iron
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// transformSep separates the IDs in the transformer chain component.
+const transformSep = "."
+
+// Transformer is a reversible stage in a chain of transformations applied to
+// payloads, configured by Options.Transformers. Its ID is recorded in the
+// sealed cookie, and must be unique among the transformers in use and
+// consist of lowercase letters, digits and hyphens.
+type Transformer interface {
+	// ID identifies the transformer.
+	ID() string
+	// Forward transforms a payload before it's encrypted.
+	Forward([]byte) ([]byte, error)
+	// Backward reverses Forward after a payload is decrypted.
+	Backward([]byte) ([]byte, error)
+}
+
+// limitedTransformer is implemented by transformers whose Backward may
+// expand a payload, so that unsealing can bound how far.
+type limitedTransformer interface {
+	// backwardLimited is Backward, but returns ErrPayloadTooLarge rather
+	// than produce more than max bytes, if max is positive.
+	backwardLimited(b []byte, max int) ([]byte, error)
+}
+
+var (
+	// GzipTransformer compresses payloads with gzip. When unsealing, it
+	// inflates payloads to at most Options.MaxPlaintextSize.
+	GzipTransformer Transformer = gzipTransformer{}
+	// Base64Transformer encodes payloads as unpadded base64url.
+	Base64Transformer Transformer = base64Transformer{}
+)
+
+type gzipTransformer struct{}
+
+func (gzipTransformer) ID() string { return "gzip" }
+
+func (gzipTransformer) Forward(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (t gzipTransformer) Backward(b []byte) ([]byte, error) {
+	return t.backwardLimited(b, 0)
+}
+
+func (gzipTransformer) backwardLimited(b []byte, max int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	return readAllLimited(r, max)
+}
+
+type base64Transformer struct{}
+
+func (base64Transformer) ID() string { return "base64" }
+
+func (base64Transformer) Forward(b []byte) ([]byte, error) {
+	out := make([]byte, base64.RawURLEncoding.EncodedLen(len(b)))
+	base64.RawURLEncoding.Encode(out, b)
+	return out, nil
+}
+
+func (base64Transformer) Backward(b []byte) ([]byte, error) {
+	out := make([]byte, base64.RawURLEncoding.DecodedLen(len(b)))
+	n, err := base64.RawURLEncoding.Decode(out, b)
+	return out[:n], err
+}
+
+// checkTransformers returns a ConfigError if any transformer's ID is
+// invalid, as it would otherwise corrupt the cookie's components.
+func checkTransformers(transformers []Transformer) error {
+	for _, t := range transformers {
+		if !validTransformerID(t.ID()) {
+			return ConfigError{fmt.Sprintf("Transformer ID %q may only contain lowercase letters, digits and hyphens", t.ID())}
+		}
+	}
+
+	return nil
+}
+
+// validTransformerID reports whether the ID is non-empty and consists of
+// lowercase letters, digits and hyphens.
+func validTransformerID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validTransformChain reports whether the transformer chain component
+// consists of valid IDs.
+func validTransformChain(chain string) bool {
+	for _, id := range strings.Split(chain, transformSep) {
+		if !validTransformerID(id) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// transformChain returns the ID of the vault's transformer chain, as
+// recorded in the cookie.
+func (v *Vault) transformChain() string {
+	ids := make([]string, len(v.opts.Transformers))
+	for i, t := range v.opts.Transformers {
+		ids[i] = t.ID()
+	}
+
+	return strings.Join(ids, transformSep)
+}
+
+// transformForward applies the vault's transformers to the payload in
+// order, recording the chain in the message.
+func (v *Vault) transformForward(msg *message, b []byte) ([]byte, error) {
+	if err := checkTransformers(v.opts.Transformers); err != nil {
+		return nil, err
+	}
+	for _, t := range v.opts.Transformers {
+		var err error
+		if b, err = t.Forward(b); err != nil {
+			return nil, err
+		}
+	}
+	msg.Transforms = v.transformChain()
+
+	return b, nil
+}
+
+// transformBackward reverses the transformers recorded in the message, in
+// reverse order. It returns an UnsealError if they aren't the vault's, or
+// can't be reversed.
+func (v *Vault) transformBackward(msg *message, b []byte) ([]byte, error) {
+	if msg.Transforms == "" {
+		return b, nil
+	}
+	if msg.Transforms != v.transformChain() {
+		return nil, UnsealError{"Transformer chain mismatch"}
+	}
+
+	for i := len(v.opts.Transformers) - 1; i >= 0; i-- {
+		var err error
+		if t, ok := v.opts.Transformers[i].(limitedTransformer); ok {
+			b, err = t.backwardLimited(b, v.opts.MaxPlaintextSize)
+		} else {
+			b, err = v.opts.Transformers[i].Backward(b)
+		}
+		if err == ErrPayloadTooLarge {
+			return nil, err
+		} else if err != nil {
+			return nil, UnsealError{"Invalid transformed payload"}
+		}
+	}
+
+	return b, nil
+}
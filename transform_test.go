@@ -0,0 +1,85 @@
+package iron
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealsWithTransformerChain(t *testing.T) {
+	v := New(Options{Secret: password, Transformers: []Transformer{GzipTransformer, Base64Transformer}})
+	payload := bytes.Repeat(source, 20)
+
+	cookie, err := v.Seal(payload)
+	assert.Nil(t, err)
+	assert.Contains(t, cookie, "*tx=gzip.base64*")
+
+	unsealed, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, unsealed)
+	size, err := v.PayloadSize(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, len(payload), size)
+
+	// Cookies sealed without transformers are still read.
+	cookie, err = New(Options{Secret: password}).Seal(payload)
+	assert.Nil(t, err)
+	unsealed, err = v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, unsealed)
+}
+
+func TestRejectsMismatchedTransformerChain(t *testing.T) {
+	cookie, err := New(Options{Secret: password, Transformers: []Transformer{GzipTransformer, Base64Transformer}}).Seal(source)
+	assert.Nil(t, err)
+
+	for _, chain := range [][]Transformer{nil, {Base64Transformer, GzipTransformer}, {GzipTransformer}} {
+		_, err = New(Options{Secret: password, Transformers: chain}).Unseal(cookie)
+		assert.Equal(t, UnsealError{"Transformer chain mismatch"}, err)
+	}
+}
+
+type idTransformer string
+
+func (t idTransformer) ID() string                      { return string(t) }
+func (idTransformer) Forward(b []byte) ([]byte, error)  { return b, nil }
+func (idTransformer) Backward(b []byte) ([]byte, error) { return b, nil }
+
+func TestRejectsInvalidTransformerIDs(t *testing.T) {
+	for _, id := range []string{"", "a*b", "a\nb", "a.b", "a=b", "Gzip"} {
+		opts := Options{Secret: password, Transformers: []Transformer{idTransformer(id)}}
+		_, err := NewChecked(opts)
+		assert.IsType(t, ConfigError{}, err, id)
+		_, err = New(opts).Seal(source)
+		assert.IsType(t, ConfigError{}, err, id)
+	}
+
+	_, err := NewChecked(Options{Secret: password, Transformers: []Transformer{idTransformer("my-codec2")}})
+	assert.Nil(t, err)
+}
+
+func TestRejectsInvalidTransformerChainComponent(t *testing.T) {
+	cookie, err := New(Options{Secret: password, Transformers: []Transformer{GzipTransformer}}).Seal(source)
+	assert.Nil(t, err)
+
+	for _, chain := range []string{"", "gzip.", "GZIP", "gz\nip"} {
+		_, err = ParseSeal(strings.Replace(cookie, "tx=gzip", "tx="+chain, 1))
+		assert.Equal(t, UnsealError{"Invalid transformer chain"}, err, chain)
+	}
+}
+
+func TestBoundsGzipTransformedPayload(t *testing.T) {
+	payload := bytes.Repeat([]byte{'x'}, 1<<20)
+	chain := []Transformer{GzipTransformer}
+	cookie, err := New(Options{Secret: password, Transformers: chain, MaxPlaintextSize: -1}).Seal(payload)
+	assert.Nil(t, err)
+
+	_, err = New(Options{Secret: password, Transformers: chain, MaxPlaintextSize: len(payload) - 1}).Unseal(cookie)
+	assert.Equal(t, ErrPayloadTooLarge, err)
+
+	unsealed, err := New(Options{Secret: password, Transformers: chain, MaxPlaintextSize: len(payload)}).Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, unsealed)
+}
@@ -0,0 +1,72 @@
+package iron
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Vector is a deterministic test vector, for checking other implementations
+// of Iron against this one. It includes the secret, so vectors should only
+// ever be generated from test secrets.
+type Vector struct {
+	Secret     []byte           `json:"secret"`
+	Plaintext  []byte           `json:"plaintext"`
+	Parameters VaultDescription `json:"parameters"`
+	Sealed     string           `json:"sealed"`
+}
+
+// vectorReader is the fixed source of salts and IVs for vectors. It reads
+// the bytes 0, 1, 2 and so on, wrapping at 255.
+type vectorReader struct{ next byte }
+
+// Read implements io.Reader.Read. It never returns an error.
+func (r *vectorReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.next
+		r.next++
+	}
+
+	return len(p), nil
+}
+
+// GenerateVector seals the plaintext with the vault's configuration, drawing
+// salts and IVs from a fixed source so that the same vault and plaintext
+// always produce the same vector. The vector never expires, regardless of
+// the vault's TTL, so that it stays valid once published.
+func GenerateVector(v *Vault, plaintext []byte) (Vector, error) {
+	opts := v.opts
+	opts.Rand = &vectorReader{}
+	opts.SaltSource = nil
+	opts.IVReuseDetector = nil
+	opts.TTL = 0
+	opts.EmbedIssuedAt = false
+	c := newVault(opts)
+
+	secret := opts.Secret
+	if opts.Secrets != nil {
+		_, current, err := c.currentSecret()
+		if err != nil {
+			return Vector{}, err
+		}
+		secret = current.opts.Secret
+	}
+
+	sealed, err := c.Seal(plaintext)
+	if err != nil {
+		return Vector{}, err
+	}
+
+	return Vector{
+		Secret:     secret,
+		Plaintext:  plaintext,
+		Parameters: c.Describe(),
+		Sealed:     sealed,
+	}, nil
+}
+
+// WriteJSON writes the vector to w as indented JSON.
+func (vec Vector) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(vec)
+}
@@ -0,0 +1,38 @@
+package iron
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratesVectors(t *testing.T) {
+	vault := New(Options{Secret: password, TTL: time.Hour})
+	vec, err := GenerateVector(vault, source)
+	assert.Nil(t, err)
+	assert.Equal(t, password, vec.Secret)
+	assert.Equal(t, source, vec.Plaintext)
+	assert.Equal(t, "aes-256-cbc", vec.Parameters.Cipher)
+	assert.Equal(t, time.Duration(0), vec.Parameters.TTL)
+
+	again, err := GenerateVector(vault, source)
+	assert.Nil(t, err)
+	assert.Equal(t, vec, again)
+
+	payload, err := vault.Unseal(vec.Sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	var buf bytes.Buffer
+	assert.Nil(t, vec.WriteJSON(&buf))
+	var decoded struct {
+		Sealed     string
+		Parameters map[string]interface{}
+	}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, vec.Sealed, decoded.Sealed)
+	assert.Equal(t, "aes-256-cbc", decoded.Parameters["Cipher"])
+}
@@ -0,0 +1,133 @@
+package iron
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrVerifyOnly is returned when sealing or unsealing with a vault which has
+// only an IntegritySecret, and so can only verify cookies.
+var ErrVerifyOnly = errors.New("iron-go: vault can only verify")
+
+// VerifierConfig describes the integrity parameters of a vault, which along
+// with its IntegritySecret are all that's needed to verify its cookies. It
+// contains no secrets, so it can be published, for instance as JSON.
+type VerifierConfig struct {
+	IntegrityHash       string        `json:"hash"`
+	IntegrityKeyBits    uint          `json:"keyBits"`
+	IntegrityIterations uint          `json:"iterations"`
+	PBKDF2Hash          string        `json:"kdf,omitempty"`
+	TimestampSkew       time.Duration `json:"skew"`
+	OmitPrefix          bool          `json:"omitPrefix,omitempty"`
+	HMACEncoding        HMACEncoding  `json:"hmacEncoding,omitempty"`
+}
+
+// verifyOnly reports whether the options have only an integrity secret.
+func (o Options) verifyOnly() bool {
+	return len(o.Secret) == 0 && o.Secrets == nil && o.IntegritySecret != nil
+}
+
+// VerifierConfig returns the configuration needed to create a verify-only
+// vault for the vault's cookies with NewVerifier. The PBKDF2Hash is empty
+// if the vault uses raw keys.
+func (v *Vault) VerifierConfig() VerifierConfig {
+	d := v.Describe()
+	return VerifierConfig{
+		IntegrityHash:       d.IntegrityHash,
+		IntegrityKeyBits:    d.IntegrityKeyBits,
+		IntegrityIterations: d.IntegrityIterations,
+		PBKDF2Hash:          d.PBKDF2Hash,
+		TimestampSkew:       v.opts.TimestampSkew,
+		OmitPrefix:          v.opts.OmitPrefix,
+		HMACEncoding:        v.opts.HMACEncoding,
+	}
+}
+
+// NewVerifier creates a verify-only vault from the config and the
+// IntegritySecret of the vault it came from. It returns an error if the
+// config names an unknown hash.
+func NewVerifier(config VerifierConfig, integritySecret []byte) (*Vault, error) {
+	hash, err := HashByName(config.IntegrityHash)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := Options{
+		IntegritySecret: integritySecret,
+		RawKey:          config.PBKDF2Hash == "",
+		TimestampSkew:   config.TimestampSkew,
+		OmitPrefix:      config.OmitPrefix,
+		HMACEncoding:    config.HMACEncoding,
+		Integrity: &Integrity{
+			Hash:       hash,
+			KeyBits:    config.IntegrityKeyBits,
+			Iterations: config.IntegrityIterations,
+			SaltBits:   32,
+		},
+	}
+	if !opts.RawKey {
+		if opts.PBKDF2Hash, err = HashByName(config.PBKDF2Hash); err != nil {
+			return nil, err
+		}
+	}
+	if len(integritySecret) == 0 {
+		return nil, ConfigError{"IntegritySecret may not be less than 32 bytes"}
+	}
+
+	return NewChecked(opts)
+}
+
+// Verify checks the cookie's expiration and integrity, without decrypting
+// it. It returns an UnsealError if the cookie is invalid, like Unseal.
+func (v *Vault) Verify(sealed string) error {
+	_, _, err := v.verify(sealed, nil)
+	return err
+}
+
+// Verifier verifies cookies sealed with a fixed integrity salt, such as by a
+// SessionVault, using an integrity key derived once up front. It's created
+// by Vault.PrecomputeVerifier.
+type Verifier struct {
+	v *Vault
+}
+
+// PrecomputeVerifier derives the integrity key for the fixed integrity salt
+// once, and returns a Verifier which checks cookies with it rather than
+// deriving a key for each one. The Verifier rejects cookies with any other
+// integrity salt. Vaults with Secrets aren't supported, since the key would
+// depend on each cookie's password ID.
+func (v *Vault) PrecomputeVerifier(intSalt []byte) (*Verifier, error) {
+	if !validFixedSalt(intSalt) {
+		return nil, ConfigError{"Integrity salt must be non-empty and may not contain separators"}
+	}
+	if v.opts.Secrets != nil {
+		return nil, ConfigError{"PrecomputeVerifier does not support Secrets"}
+	}
+
+	secret := v.opts.Secret
+	if v.opts.IntegritySecret != nil {
+		secret = v.opts.IntegritySecret
+	}
+	c := *v
+	c.opts.Secret = secret
+	integrity := v.opts.Integrity
+	key, err := c.generateKey(integrityKey, integrity.KeyBits, integrity.Iterations, intSalt)
+	if err != nil {
+		return nil, err
+	}
+
+	v.zero.track(key)
+	c = *v
+	c.session = &session{
+		secret:       secret,
+		intSalt:      intSalt,
+		intKey:       sessionKey{integrity.KeyBits, integrity.Iterations, key},
+		fixedIntSalt: true,
+	}
+	return &Verifier{v: &c}, nil
+}
+
+// Verify checks the cookie's expiration and integrity like Vault.Verify.
+func (p *Verifier) Verify(sealed string) error {
+	return p.v.Verify(sealed)
+}
@@ -0,0 +1,124 @@
+package iron
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var integritySecret = []byte(strings.Repeat("i", 32))
+
+func TestVerifiesWithExportedConfig(t *testing.T) {
+	v := New(Options{Secret: password, IntegritySecret: integritySecret})
+	cookie, err := v.Seal(source)
+	assert.Nil(t, err)
+	payload, err := v.Unseal(cookie)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	exported, err := json.Marshal(v.VerifierConfig())
+	assert.Nil(t, err)
+	var config VerifierConfig
+	assert.Nil(t, json.Unmarshal(exported, &config))
+	assert.NotContains(t, string(exported), string(password))
+	assert.NotContains(t, string(exported), string(integritySecret))
+
+	verifier, err := NewVerifier(config, integritySecret)
+	assert.Nil(t, err)
+	assert.Nil(t, verifier.Verify(cookie))
+	assert.Equal(t, UnsealError{"Bad hmac value"}, verifier.Verify(strings.Replace(cookie, "**", "*x*", 1)))
+
+	_, err = verifier.Unseal(cookie)
+	assert.Equal(t, ErrVerifyOnly, err)
+	_, err = verifier.Seal(source)
+	assert.Equal(t, ErrVerifyOnly, err)
+	_, err = verifier.PayloadSize(cookie)
+	assert.Equal(t, ErrVerifyOnly, err)
+
+	// The encryption secret alone can't verify.
+	assert.Equal(t, UnsealError{"Bad hmac value"}, New(Options{Secret: password}).Verify(cookie))
+}
+
+func TestNewVerifierRequiresIntegritySecret(t *testing.T) {
+	config := New(Options{Secret: password}).VerifierConfig()
+	_, err := NewVerifier(config, nil)
+	assert.Equal(t, ConfigError{"IntegritySecret may not be less than 32 bytes"}, err)
+	_, err = NewVerifier(config, []byte("short"))
+	assert.Equal(t, ConfigError{"IntegritySecret may not be less than 32 bytes"}, err)
+}
+
+func TestRejectsIntegritySecretWithSecrets(t *testing.T) {
+	opts := Options{
+		IntegritySecret: rawKey,
+		Secrets:         SecretMap{CurrentID: "a", Secrets: map[string][]byte{"a": password}},
+	}
+	_, err := NewChecked(opts)
+	assert.Equal(t, ConfigError{"IntegritySecret is not supported with Secrets"}, err)
+	assert.Panics(t, func() { New(opts) })
+}
+
+func TestPrecomputedVerifierMatchesVerify(t *testing.T) {
+	v := New(Options{Secret: password})
+	cookie, err := v.Session(encSalt, intSalt).Seal(source)
+	assert.Nil(t, err)
+	other, err := v.Seal(source)
+	assert.Nil(t, err)
+	tampered := strings.Replace(cookie, "**", "*x*", 1)
+
+	verifier, err := v.PrecomputeVerifier(intSalt)
+	assert.Nil(t, err)
+	assert.Nil(t, verifier.Verify(cookie))
+	assert.Equal(t, v.Verify(tampered), verifier.Verify(tampered))
+	assert.Nil(t, v.Verify(other))
+	assert.Equal(t, UnsealError{"Unexpected integrity salt"}, verifier.Verify(other))
+
+	// Verify-only vaults can precompute too.
+	sealer := New(Options{Secret: password, IntegritySecret: integritySecret})
+	cookie, err = sealer.Session(encSalt, intSalt).Seal(source)
+	assert.Nil(t, err)
+	edge, err := NewVerifier(sealer.VerifierConfig(), integritySecret)
+	assert.Nil(t, err)
+	verifier, err = edge.PrecomputeVerifier(intSalt)
+	assert.Nil(t, err)
+	assert.Nil(t, verifier.Verify(cookie))
+
+	_, err = v.PrecomputeVerifier([]byte("a*b"))
+	assert.IsType(t, ConfigError{}, err)
+}
+
+// slowIntegrity is an integrity configuration whose key derivation is slow
+// enough to dominate verification.
+var slowIntegrity = &Integrity{KeyBits: 256, Iterations: 10000, SaltBits: 32, Hash: sha256.New}
+
+func BenchmarkVerify(b *testing.B) {
+	v := New(Options{Secret: password, Integrity: slowIntegrity})
+	cookie, err := v.Session(encSalt, intSalt).Seal(source)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		if err := v.Verify(cookie); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPrecomputedVerify(b *testing.B) {
+	v := New(Options{Secret: password, Integrity: slowIntegrity})
+	cookie, err := v.Session(encSalt, intSalt).Seal(source)
+	if err != nil {
+		b.Fatal(err)
+	}
+	verifier, err := v.PrecomputeVerifier(intSalt)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		if err := verifier.Verify(cookie); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package iron
+
+// SealWithKey seals the payload like Seal, but encrypts and authenticates
+// it with the given keys rather than keys derived from the secret, for keys
+// derived elsewhere, such as by an HSM. The keys must be exactly
+// Encryption.KeyBits and Integrity.KeyBits long. Salts are still written,
+// so the cookie has the usual layout, but they play no part in the keys.
+// The caller is responsible for generating, storing and rotating the keys.
+func (v *Vault) SealWithKey(b, encKey, intKey []byte) (string, error) {
+	c, err := v.withKeys(encKey, intKey)
+	if err != nil {
+		return "", err
+	}
+
+	return c.Seal(b)
+}
+
+// UnsealWithKey unseals a cookie sealed by SealWithKey with the same keys.
+func (v *Vault) UnsealWithKey(sealed string, encKey, intKey []byte) ([]byte, error) {
+	c, err := v.withKeys(encKey, intKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Unseal(sealed)
+}
+
+// withKeys returns a copy of the vault which uses the keys as raw keys. It
+// returns ErrRawKeyLength if either key is the wrong length.
+func (v *Vault) withKeys(encKey, intKey []byte) (*Vault, error) {
+	if uint(len(encKey))*8 != v.opts.Encryption.KeyBits || uint(len(intKey))*8 != v.opts.Integrity.KeyBits {
+		return nil, ErrRawKeyLength
+	}
+
+	c := *v
+	c.suppliedKeys = true
+	c.opts.RawKey = true
+	c.opts.Secret = encKey
+	c.opts.IntegritySecret = intKey
+	c.opts.Secrets = nil
+	c.session = nil
+	return &c, nil
+}
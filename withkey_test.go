@@ -0,0 +1,35 @@
+package iron
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealsWithSuppliedKeys(t *testing.T) {
+	v := New(Options{Secret: password})
+	encKey := bytes.Repeat([]byte{1}, 32)
+	intKey := bytes.Repeat([]byte{2}, 32)
+
+	sealed, err := v.SealWithKey(source, encKey, intKey)
+	assert.Nil(t, err)
+	payload, err := v.UnsealWithKey(sealed, encKey, intKey)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+
+	// Any vault with the same parameters can unseal it with the keys, and
+	// none can without them.
+	payload, err = New(Options{Secret: rawKey}).UnsealWithKey(sealed, encKey, intKey)
+	assert.Nil(t, err)
+	assert.Equal(t, source, payload)
+	_, err = v.Unseal(sealed)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+	_, err = v.UnsealWithKey(sealed, intKey, encKey)
+	assert.Equal(t, UnsealError{"Bad hmac value"}, err)
+
+	_, err = v.SealWithKey(source, encKey[:16], intKey)
+	assert.Equal(t, ErrRawKeyLength, err)
+	_, err = v.UnsealWithKey(sealed, encKey, intKey[:31])
+	assert.Equal(t, ErrRawKeyLength, err)
+}
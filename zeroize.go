@@ -0,0 +1,79 @@
+package iron
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ErrZeroized is returned when using a vault after Zeroize.
+var ErrZeroized = ConfigError{"Vault has been zeroized"}
+
+// zeroizer is shared by a vault and every copy made from it, such as its
+// sessions, so that zeroizing any of them zeroizes them all.
+type zeroizer struct {
+	done int32
+
+	mu sync.Mutex
+	// keys are the keys derived and held by copies of the vault, zeroed
+	// along with the secrets.
+	keys [][]byte
+}
+
+// track records keys held by a copy of the vault, to be zeroed by Zeroize.
+// If the vault has already been zeroized, they're zeroed at once.
+func (z *zeroizer) track(keys ...[]byte) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if atomic.LoadInt32(&z.done) != 0 {
+		for _, key := range keys {
+			zero(key)
+		}
+		return
+	}
+	z.keys = append(z.keys, keys...)
+}
+
+// Zeroize overwrites the vault's secrets with zeros, along with any keys it
+// and its sessions have derived from them and cached, and makes the vault
+// unusable: sealing and unsealing with it, or with any session or copy
+// made from it, fail with ErrZeroized from then on. It should be called
+// only once the vault is no longer in use, such as on shutdown. The secrets
+// are zeroed in place, so slices passed in Options are zeroed too. Secrets
+// held by a SecretProvider aren't the vault's to wipe.
+func (v *Vault) Zeroize() {
+	v.zero.mu.Lock()
+	defer v.zero.mu.Unlock()
+	atomic.StoreInt32(&v.zero.done, 1)
+
+	zero(v.opts.Secret)
+	zero(v.opts.IntegritySecret)
+	zero(v.fastKey)
+	for _, key := range v.zero.keys {
+		zero(key)
+	}
+	v.zero.keys = nil
+}
+
+// Zeroize zeroes the session's secret and keys like Vault.Zeroize. The
+// session shares its secret and state with the vault it was created from,
+// so that vault, and its other sessions, are zeroized too.
+func (s *SessionVault) Zeroize() {
+	if s.v != nil {
+		s.v.Zeroize()
+	}
+}
+
+// checkZeroized returns ErrZeroized if the vault has been zeroized.
+func (v *Vault) checkZeroized() error {
+	if atomic.LoadInt32(&v.zero.done) != 0 {
+		return ErrZeroized
+	}
+	return nil
+}
+
+// zero overwrites b with zeros.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,100 @@
+package iron
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZeroizeWipesSecret(t *testing.T) {
+	secret := append([]byte(nil), password...)
+	v := New(Options{Secret: secret, FastReject: true})
+	sealed, err := v.Seal([]byte("payload"))
+	assert.Nil(t, err)
+
+	v.Zeroize()
+	assert.Equal(t, make([]byte, len(password)), secret)
+	assert.Equal(t, make([]byte, len(v.fastKey)), v.fastKey)
+
+	_, err = v.Seal([]byte("payload"))
+	assert.Equal(t, ErrZeroized, err)
+	_, err = v.Unseal(sealed)
+	assert.Equal(t, ErrZeroized, err)
+	assert.Equal(t, "Vault has been zeroized", err.Error())
+}
+
+func TestZeroizeWipesSessionKeys(t *testing.T) {
+	secret := append([]byte(nil), password...)
+	v := New(Options{Secret: secret})
+	s := v.Session([]byte("enc-salt"), []byte("int-salt"))
+	sealed, err := s.Seal([]byte("payload"))
+	assert.Nil(t, err)
+
+	s.Zeroize()
+	assert.Equal(t, make([]byte, len(password)), secret)
+	for _, key := range [][]byte{s.v.session.encKey.key, s.v.session.intKey.key} {
+		assert.True(t, len(key) > 0)
+		assert.True(t, bytes.Equal(make([]byte, len(key)), key))
+	}
+
+	_, err = s.Seal([]byte("payload"))
+	assert.Equal(t, ErrZeroized, err)
+	_, err = s.Unseal(sealed)
+	assert.Equal(t, ErrZeroized, err)
+	_, err = v.Seal([]byte("payload"))
+	assert.Equal(t, ErrZeroized, err)
+}
+
+func TestZeroizeWipesExistingSessions(t *testing.T) {
+	v := New(Options{Secret: append([]byte(nil), password...)})
+	s := v.Session([]byte("enc-salt"), []byte("int-salt")).WithCounterIVs()
+	sealed, err := s.Seal([]byte("payload"))
+	assert.Nil(t, err)
+	p, err := v.PrecomputeVerifier([]byte("int-salt"))
+	assert.Nil(t, err)
+
+	v.Zeroize()
+	for _, key := range [][]byte{s.v.session.encKey.key, s.v.session.intKey.key, s.v.session.ivs.prefix, p.v.session.intKey.key} {
+		assert.True(t, len(key) > 0)
+		assert.True(t, bytes.Equal(make([]byte, len(key)), key))
+	}
+
+	_, err = s.Seal([]byte("payload"))
+	assert.Equal(t, ErrZeroized, err)
+	_, err = s.Unseal(sealed)
+	assert.Equal(t, ErrZeroized, err)
+	assert.Equal(t, ErrZeroized, p.Verify(sealed))
+}
+
+func TestZeroizeLeavesOtherVaultsUsable(t *testing.T) {
+	v := New(Options{Secret: append([]byte(nil), password...)})
+	other := New(Options{Secret: password})
+	sealed, err := other.Seal([]byte("payload"))
+	assert.Nil(t, err)
+
+	v.Zeroize()
+	payload, err := other.Unseal(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, "payload", string(payload))
+}
+
+func TestZeroizeWipesSubjectVaults(t *testing.T) {
+	v := New(Options{Secret: append([]byte(nil), password...), FastReject: true})
+	alice := v.ForSubject([]byte("alice"))
+	sealed, err := alice.Seal([]byte("payload"))
+	assert.Nil(t, err)
+
+	v.Zeroize()
+	for _, key := range [][]byte{alice.opts.Secret, alice.fastKey} {
+		assert.True(t, len(key) > 0)
+		assert.True(t, bytes.Equal(make([]byte, len(key)), key))
+	}
+	_, err = alice.Seal([]byte("payload"))
+	assert.Equal(t, ErrZeroized, err)
+	_, err = alice.Unseal(sealed)
+	assert.Equal(t, ErrZeroized, err)
+
+	_, err = v.ForSubject([]byte("bob")).Seal([]byte("payload"))
+	assert.Equal(t, ErrZeroized, err)
+}